@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// A project that would autoplan for a change
+type affectedProject struct {
+	Dir string `json:"dir"`
+
+	// Changed files matching its `when_modified` entries, relative to the repo root
+	ChangedFiles []string `json:"changed_files"`
+}
+
+// A local module whose changes autoplan several projects
+type fanOutModule struct {
+	// Dir of the module, relative to the repo root
+	Dir string `json:"dir"`
+
+	// Projects autoplanned because of changes in the module
+	Projects []string `json:"projects"`
+}
+
+type blastRadiusReport struct {
+	ChangedFiles     []string          `json:"changed_files"`
+	AffectedProjects []affectedProject `json:"affected_projects"`
+	Modules          []fanOutModule    `json:"modules"`
+}
+
+// Finds the projects with autoplan enabled that a change of `changedFiles` would plan, and the local modules through
+// which the changes reach them
+func computeBlastRadius(changedFiles []string) (blastRadiusReport, error) {
+	report := blastRadiusReport{
+		ChangedFiles:     changedFiles,
+		AffectedProjects: []affectedProject{},
+		Modules:          []fanOutModule{},
+	}
+
+	rootModules, err := getAllTerraformRootModules(gitRoot)
+	if err != nil {
+		return report, err
+	}
+
+	projectsByModule := map[string][]string{}
+	for _, path := range rootModules {
+		project, err := createProject(path)
+		if err != nil {
+			return report, err
+		}
+		if project == nil || !project.Autoplan.Enabled {
+			continue
+		}
+
+		rootModule, _ := loadConfigDir(path)
+		affected := affectedProject{Dir: project.Dir, ChangedFiles: matchingChangedFiles(project, path, changedFiles)}
+		if len(affected.ChangedFiles) == 0 {
+			continue
+		}
+
+		modules := map[string]bool{}
+		for _, file := range affected.ChangedFiles {
+			if chain := findModuleChain(rootModule, filepath.Join(gitRoot, filepath.FromSlash(file))); len(chain) > 0 {
+				modules[chain[len(chain)-1].Dir] = true
+			}
+		}
+
+		report.AffectedProjects = append(report.AffectedProjects, affected)
+		for module := range modules {
+			projectsByModule[module] = append(projectsByModule[module], project.Dir)
+		}
+	}
+	sort.Slice(report.AffectedProjects, func(i, j int) bool { return report.AffectedProjects[i].Dir < report.AffectedProjects[j].Dir })
+
+	for dir, projects := range projectsByModule {
+		sort.Strings(projects)
+		report.Modules = append(report.Modules, fanOutModule{Dir: dir, Projects: projects})
+	}
+	// The modules planning the most projects come first, as they are the ones to look at
+	sort.Slice(report.Modules, func(i, j int) bool {
+		a, b := report.Modules[i], report.Modules[j]
+		if len(a.Projects) != len(b.Projects) {
+			return len(a.Projects) > len(b.Projects)
+		}
+		return a.Dir < b.Dir
+	})
+
+	return report, nil
+}
+
+// Lists the changed files, relative to the repo root, which match the `when_modified` entries of a project in `path`
+func matchingChangedFiles(project *AtlantisProject, path string, changedFiles []string) []string {
+	matching := []string{}
+	for _, file := range changedFiles {
+		relativePath, err := filepath.Rel(path, filepath.Join(gitRoot, filepath.FromSlash(file)))
+		if err != nil {
+			continue
+		}
+		if _, ok := whenModifiedMatch(project.Autoplan.WhenModified, filepath.ToSlash(relativePath)); ok {
+			matching = append(matching, file)
+		}
+	}
+
+	return matching
+}
+
+func printBlastRadius(cmd *cobra.Command, report blastRadiusReport) error {
+	out := cmd.OutOrStdout()
+	if blastRadiusFormat == jsonFormat {
+		return writeJSON(out, report)
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "%d projects would autoplan for %d changed files\n", len(report.AffectedProjects), len(report.ChangedFiles))
+	for _, project := range report.AffectedProjects {
+		fmt.Fprintf(writer, "  %s\t%s\n", project.Dir, strings.Join(project.ChangedFiles, ", "))
+	}
+	if len(report.Modules) > 0 {
+		fmt.Fprintln(writer, "Modules causing the fan-out:")
+		for _, module := range report.Modules {
+			fmt.Fprintf(writer, "  %s\t%d projects\t%s\n", module.Dir, len(module.Projects), strings.Join(module.Projects, ", "))
+		}
+	}
+
+	return writer.Flush()
+}
+
+// Reads the changed files from the arguments, or one per line from stdin when there are none, like the output of
+// `git diff --name-only`
+func readChangedFiles(cmd *cobra.Command, args []string) ([]string, error) {
+	lines := args
+	if len(lines) == 0 {
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	files := []string{}
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, filepath.ToSlash(filepath.Clean(line)))
+		}
+	}
+
+	return uniqueStrings(files), nil
+}
+
+func blastRadius(cmd *cobra.Command, args []string) error {
+	if blastRadiusFormat != textFormat && blastRadiusFormat != jsonFormat {
+		return fmt.Errorf("unknown --format %q, must be %s or %s", blastRadiusFormat, textFormat, jsonFormat)
+	}
+	if err := resolveGitRoot(); err != nil {
+		return err
+	}
+	if err := loadProjectRules(); err != nil {
+		return err
+	}
+
+	changedFiles, err := readChangedFiles(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	report, err := computeBlastRadius(changedFiles)
+	if err != nil {
+		return err
+	}
+	if err := printBlastRadius(cmd, report); err != nil {
+		return err
+	}
+
+	if maxAffected > 0 && len(report.AffectedProjects) > maxAffected {
+		causes := []string{}
+		for _, module := range report.Modules {
+			causes = append(causes, fmt.Sprintf("%s (%d projects)", module.Dir, len(module.Projects)))
+		}
+		message := fmt.Sprintf("the change would autoplan %d projects, more than the %d allowed by --max-affected", len(report.AffectedProjects), maxAffected)
+		if len(causes) > 0 {
+			message += "; the changes reach them through " + strings.Join(causes, ", ")
+		}
+		return errors.New(message)
+	}
+
+	return nil
+}
+
+var blastRadiusFormat string
+var maxAffected int
+
+// blastRadiusCmd represents the blast-radius command
+var blastRadiusCmd = &cobra.Command{
+	Use:   "blast-radius [changed files...]",
+	Short: "Reports how many projects a change would autoplan",
+	Long:  `Reports the projects whose 'when_modified' entries match the changed files, relative to --root, and the local modules through which the changes reach them. Reads the changed files from stdin, one per line, when none are passed. Takes the same flags as generate`,
+	RunE:  blastRadius,
+}
+
+func init() {
+	rootCmd.AddCommand(blastRadiusCmd)
+
+	addGenerateFlags(blastRadiusCmd.Flags())
+	blastRadiusCmd.Flags().StringVar(&blastRadiusFormat, "format", textFormat, "Output format, text or json")
+	blastRadiusCmd.Flags().IntVar(&maxAffected, "max-affected", 0, "Fails if the change would autoplan more projects than this. 0 for no limit")
+}
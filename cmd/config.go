@@ -6,64 +6,71 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/ghodss/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 // Represents an entire config file
 type AtlantisConfig struct {
 	// Version of the config syntax
-	Version int `json:"version"`
+	Version int `json:"version" yaml:"version"`
 
 	// If Atlantis should merge after finishing `atlantis apply`
-	AutoMerge bool `json:"automerge"`
+	AutoMerge bool `json:"automerge" yaml:"automerge"`
 
 	// If Atlantis should allow plans to occur in parallel
-	ParallelPlan bool `json:"parallel_plan"`
+	ParallelPlan bool `json:"parallel_plan" yaml:"parallel_plan"`
 
 	// If Atlantis should allow applies to occur in parallel
-	ParallelApply bool `json:"parallel_apply"`
+	ParallelApply bool `json:"parallel_apply" yaml:"parallel_apply"`
 
 	// The project settings
-	Projects []AtlantisProject `json:"projects,omitempty"`
+	Projects []AtlantisProject `json:"projects,omitempty" yaml:"projects,omitempty"`
 
 	// Workflows, which are not managed by this library other than
 	// the fact that this library preserves any existing workflows
-	Workflows interface{} `json:"workflows,omitempty"`
+	Workflows interface{} `json:"workflows,omitempty" yaml:"workflows,omitempty"`
 }
 
 // Represents an Atlantis Project directory
 type AtlantisProject struct {
 	// The directory with the terragrunt.hcl file
-	Dir string `json:"dir"`
+	Dir string `json:"dir" yaml:"dir"`
 
 	// Define workflow name
-	Workflow string `json:"workflow,omitempty"`
+	Workflow string `json:"workflow,omitempty" yaml:"workflow,omitempty"`
 
 	// Define workspace name
-	Workspace string `json:"workspace,omitempty"`
+	Workspace string `json:"workspace,omitempty" yaml:"workspace,omitempty"`
 
 	// Define project name
-	Name string `json:"name,omitempty"`
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
 
 	// Autoplan settings for which plans affect other plans
-	Autoplan AutoplanConfig `json:"autoplan"`
+	Autoplan AutoplanConfig `json:"autoplan" yaml:"autoplan"`
 
 	// The terraform version to use for this project
-	TerraformVersion string `json:"terraform_version,omitempty"`
+	TerraformVersion string `json:"terraform_version,omitempty" yaml:"terraform_version,omitempty"`
+
+	// Set to `opentofu` when the version is an OpenTofu one
+	TerraformDistribution string `json:"terraform_distribution,omitempty" yaml:"terraform_distribution,omitempty"`
 
 	// We only want to output `apply_requirements` if explicitly stated in a local value
-	ApplyRequirements *[]string `json:"apply_requirements,omitempty"`
+	ApplyRequirements *[]string `json:"apply_requirements,omitempty" yaml:"apply_requirements,omitempty"`
 
 	// Atlantis use ExecutionOrderGroup for sort projects before applying/planning
-	ExecutionOrderGroup int `json:"execution_order_group,omitempty"`
+	ExecutionOrderGroup int `json:"execution_order_group,omitempty" yaml:"execution_order_group,omitempty"`
+
+	// The group pinned in locals, which --execution-order-groups has to respect
+	executionOrderGroupPin *int
 }
 
 // Autoplan settings for which plans affect other plans
 type AutoplanConfig struct {
 	// Relative paths from this modules directory to modules it depends on
-	WhenModified []string `json:"when_modified"`
+	WhenModified []string `json:"when_modified" yaml:"when_modified"`
 
 	// If autoplan should be enabled for this dir
-	Enabled bool `json:"enabled"`
+	Enabled bool `json:"enabled" yaml:"enabled"`
 }
 
 // Checks if an output file already exists. If it does, it reads it
@@ -78,10 +85,28 @@ func readOldConfig() (*AtlantisConfig, error) {
 
 	// The old file being malformed is an actual error
 	config := AtlantisConfig{}
-	err = yaml.Unmarshal(bytes, &config)
+	err = yaml.Unmarshal(stripGeneratedHeader(bytes), &config)
 	if err != nil {
 		return nil, err
 	}
 
 	return &config, nil
 }
+
+// Reads the old config as a YAML document, to keep its comments. Returns nil if there is no old config
+func readOldDocument() (*yamlv3.Node, error) {
+	bytes, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		return nil, nil
+	}
+
+	document := yamlv3.Node{}
+	if err := yamlv3.Unmarshal(stripGeneratedHeader(bytes), &document); err != nil {
+		return nil, err
+	}
+	if document.Kind == 0 {
+		return nil, nil
+	}
+
+	return &document, nil
+}
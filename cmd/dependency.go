@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// Ways a `when_modified` entry of a project can be found
+const (
+	mechanismAutoPlanFileList    = "autoplan file list"
+	mechanismExtraDependency     = "extra dependency"
+	mechanismLocalModule         = "local module"
+	mechanismFileFunction        = "file function"
+	mechanismPathAttribute       = "path attribute"
+	mechanismWhenModifiedExclude = "when_modified exclude"
+)
+
+// A file or glob a project depends on, together with what declared it
+type dependency struct {
+	// Absolute path or glob. Extra dependencies are kept as written, relative to the module or the repo root
+	path string
+
+	// How the dependency was found, one of the mechanism constants
+	mechanism string
+
+	// What declared it, like `module "vpc"` or `templatefile()`
+	detail string
+
+	// Where it was declared. Empty for dependencies coming from flags
+	source hcl.Range
+}
+
+// Adds a dependency to a set keyed by path. When the same path is found more than once,
+// the declaration that comes first in the files is kept, so the result does not depend on map order
+func addDependency(dependencies map[string]dependency, dep dependency) {
+	existing, ok := dependencies[dep.path]
+	if ok && !rangeBefore(dep.source, existing.source) {
+		return
+	}
+	dependencies[dep.path] = dep
+}
+
+// Lists the dependencies of a set, sorted by path
+func sortedDependencies(dependencies map[string]dependency) []dependency {
+	sorted := []dependency{}
+	for _, dep := range dependencies {
+		sorted = append(sorted, dep)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].path < sorted[j].path })
+
+	return sorted
+}
+
+func rangeBefore(a hcl.Range, b hcl.Range) bool {
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	return a.Start.Byte < b.Start.Byte
+}
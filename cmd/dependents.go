@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/hashicorp/terraform/configs"
+	"github.com/spf13/cobra"
+)
+
+// Output formats of the report commands
+const (
+	textFormat = "text"
+	jsonFormat = "json"
+	csvFormat  = "csv"
+)
+
+// A project depending on the looked up path
+type dependentProject struct {
+	Dir string `json:"dir"`
+
+	// The `when_modified` entry that autoplans the project when the path changes. Empty if it is not autoplanned
+	WhenModified string `json:"when_modified,omitempty"`
+
+	// Module calls leading from the project to the module containing the path, empty if the path is not in a module
+	ModuleChain []moduleCallStep `json:"module_chain,omitempty"`
+}
+
+// A single call in a chain of local module calls
+type moduleCallStep struct {
+	Module string `json:"module"`
+
+	// Dir of the called module, relative to the repo root
+	Dir string `json:"dir"`
+
+	// Where the call is declared, as `file:line` relative to the repo root
+	DeclaredAt string `json:"declared_at"`
+}
+
+func (s moduleCallStep) String() string {
+	return fmt.Sprintf("module %q (%s)", s.Module, s.DeclaredAt)
+}
+
+type dependentsReport struct {
+	Path     string             `json:"path"`
+	Projects []dependentProject `json:"projects"`
+}
+
+// Finds the shortest chain of local module calls from `rootModule` to the innermost module containing `target`.
+// Returns nil if no called module contains it
+func findModuleChain(rootModule *configs.Module, target string) []moduleCallStep {
+	chains := map[string][]moduleCallStep{rootModule.SourceDir: {}}
+	queue := []*configs.Module{rootModule}
+	var found []moduleCallStep
+	foundDir := ""
+
+	for len(queue) > 0 {
+		module := queue[0]
+		queue = queue[1:]
+
+		names := []string{}
+		for name := range module.ModuleCalls {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			mc := module.ModuleCalls[name]
+			modulePath, ok := localModuleSourceDir(module, mc)
+			if !ok {
+				continue
+			}
+			modulePath = filepath.Clean(modulePath)
+			if _, visited := chains[modulePath]; visited {
+				continue
+			}
+
+			chain := append(append([]moduleCallStep{}, chains[module.SourceDir]...), moduleCallStep{
+				Module:     name,
+				Dir:        relativeFile(modulePath),
+				DeclaredAt: relativeRange(mc.DeclRange),
+			})
+			chains[modulePath] = chain
+
+			if isInDir(target, modulePath) && len(modulePath) > len(foundDir) {
+				found, foundDir = chain, modulePath
+			}
+
+			subModule, _ := loadConfigDir(modulePath)
+			if subModule != nil {
+				queue = append(queue, subModule)
+			}
+		}
+	}
+
+	return found
+}
+
+func isInDir(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// Lists the files a change of `target` stands for: the files directly in it for a directory, or the path itself
+func filesUnderTarget(target string) []string {
+	entries, err := ioutil.ReadDir(target)
+	if err != nil {
+		return []string{target}
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, filepath.Join(target, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return []string{target}
+	}
+
+	return files
+}
+
+// Finds the projects depending on `target`, either through their `when_modified` entries or through module calls
+func findDependents(target string) ([]dependentProject, error) {
+	rootModules, err := getAllTerraformRootModules(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	files := filesUnderTarget(target)
+	dependents := []dependentProject{}
+	for _, path := range rootModules {
+		project, err := createProject(path)
+		if err != nil {
+			return nil, err
+		}
+		if project == nil {
+			continue
+		}
+
+		dependent := dependentProject{Dir: project.Dir}
+		for _, file := range files {
+			relativePath, err := filepath.Rel(path, file)
+			if err != nil {
+				return nil, err
+			}
+			if entry, ok := whenModifiedMatch(project.Autoplan.WhenModified, filepath.ToSlash(relativePath)); ok {
+				dependent.WhenModified = entry
+				break
+			}
+		}
+
+		rootModule, _ := loadConfigDir(path)
+		dependent.ModuleChain = findModuleChain(rootModule, target)
+
+		if dependent.WhenModified != "" || dependent.ModuleChain != nil {
+			dependents = append(dependents, dependent)
+		}
+	}
+	sort.Slice(dependents, func(i, j int) bool { return dependents[i].Dir < dependents[j].Dir })
+
+	return dependents, nil
+}
+
+func printDependents(cmd *cobra.Command, report dependentsReport) error {
+	out := cmd.OutOrStdout()
+	if dependentsFormat == jsonFormat {
+		return writeJSON(out, report)
+	}
+
+	if len(report.Projects) == 0 {
+		fmt.Fprintf(out, "No projects depend on %s\n", report.Path)
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "Projects depending on %s:\n", report.Path)
+	for _, project := range report.Projects {
+		trigger := "not autoplanned"
+		if project.WhenModified != "" {
+			trigger = "when_modified " + project.WhenModified
+		}
+
+		chain := []string{}
+		for _, step := range project.ModuleChain {
+			chain = append(chain, step.String())
+		}
+		via := "-"
+		if len(chain) > 0 {
+			via = strings.Join(chain, " -> ")
+		}
+
+		fmt.Fprintf(writer, "  %s\t%s\t%s\n", project.Dir, trigger, via)
+	}
+
+	return writer.Flush()
+}
+
+func listDependents(cmd *cobra.Command, args []string) error {
+	if dependentsFormat != textFormat && dependentsFormat != jsonFormat {
+		return fmt.Errorf("unknown --format %q, must be %s or %s", dependentsFormat, textFormat, jsonFormat)
+	}
+	if err := resolveGitRoot(); err != nil {
+		return err
+	}
+	if err := loadProjectRules(); err != nil {
+		return err
+	}
+
+	target := args[0]
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(gitRoot, target)
+	}
+	target = filepath.Clean(target)
+
+	relativePath, ok := relativeToGitRoot(target)
+	if !ok {
+		return fmt.Errorf("%s is outside of the repo", args[0])
+	}
+	if _, err := os.Stat(target); err != nil {
+		return err
+	}
+
+	dependents, err := findDependents(target)
+	if err != nil {
+		return err
+	}
+
+	return printDependents(cmd, dependentsReport{Path: relativePath, Projects: dependents})
+}
+
+var dependentsFormat string
+
+// dependentsCmd represents the dependents command
+var dependentsCmd = &cobra.Command{
+	Use:   "dependents <path>",
+	Short: "Lists the projects depending on a module or file",
+	Long:  `Lists the projects whose 'when_modified' entries match <path>, relative to --root, or which call a local module containing it, directly or through other modules. Takes the same flags as generate`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  listDependents,
+}
+
+func init() {
+	rootCmd.AddCommand(dependentsCmd)
+
+	addGenerateFlags(dependentsCmd.Flags())
+	dependentsCmd.Flags().StringVar(&dependentsFormat, "format", textFormat, "Output format, text or json")
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/configs"
+	log "github.com/sirupsen/logrus"
+)
+
+// Collects the HCL diagnostics of every file loaded during a run, so they can be reported once at the end
+type diagnosticsCollector struct {
+	lock sync.Mutex
+
+	diags hcl.Diagnostics
+
+	// Sources of the files with diagnostics, used to print snippets
+	files map[string]*hcl.File
+
+	// The same directory is usually loaded more than once, but each diagnostic should only be reported once
+	seen map[string]bool
+}
+
+func newDiagnosticsCollector() *diagnosticsCollector {
+	return &diagnosticsCollector{
+		files: map[string]*hcl.File{},
+		seen:  map[string]bool{},
+	}
+}
+
+var collectedDiagnostics = newDiagnosticsCollector()
+
+// Records the diagnostics not seen before. Returns how many were new
+func (c *diagnosticsCollector) add(sources map[string][]byte, diags hcl.Diagnostics) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	added := 0
+	for _, diag := range diags {
+		if isNewerTerraformDiagnostic(diag) {
+			log.Debugf("Ignoring %q at %s, which Terraform versions after the parser of this tool support", diag.Summary, diag.Subject)
+			continue
+		}
+
+		key := fmt.Sprintf("%d|%s|%s|%s", diag.Severity, diag.Summary, diag.Detail, diag.Subject)
+		if c.seen[key] {
+			continue
+		}
+		c.seen[key] = true
+		c.diags = append(c.diags, diag)
+		added++
+
+		if diag.Subject == nil {
+			continue
+		}
+		if _, ok := c.files[diag.Subject.Filename]; ok {
+			continue
+		}
+		src, ok := sources[diag.Subject.Filename]
+		if !ok {
+			// Diagnostics raised outside the parser point at files which may not have been kept in memory
+			src, _ = ioutil.ReadFile(diag.Subject.Filename)
+		}
+		c.files[diag.Subject.Filename] = &hcl.File{Bytes: src}
+	}
+
+	return added
+}
+
+// Blocks added after Terraform v0.15, whose parser is used to read modules
+var newerBlockTypes = []string{"moved", "import", "check", "removed"}
+
+// Checks if a diagnostic is only raised because the parser of Terraform v0.15 does not know about features
+// of later versions, like `moved` blocks or `optional()` attributes with a default
+func isNewerTerraformDiagnostic(diag *hcl.Diagnostic) bool {
+	switch diag.Summary {
+	case "Unsupported block type":
+		for _, blockType := range newerBlockTypes {
+			if diag.Detail == fmt.Sprintf("Blocks of type %q are not expected here.", blockType) {
+				return true
+			}
+		}
+	case "Invalid type specification":
+		return strings.HasPrefix(diag.Detail, "Optional attribute modifier expects only one argument")
+	case "Optional object type attributes are experimental":
+		return true
+	}
+
+	return false
+}
+
+// Loads a Terraform or OpenTofu module, recording its diagnostics. The module may be incomplete if there are errors
+func loadConfigDir(path string) (*configs.Module, hcl.Diagnostics) {
+	parser := configs.NewParser(nil)
+	module, diags := loadConfigDirFiles(parser, path)
+	collectedDiagnostics.add(parser.Sources(), diags)
+
+	return module, diags
+}
+
+// Loads a single file in the Terraform syntax, recording its diagnostics
+func loadConfigFile(path string) (*configs.File, hcl.Diagnostics) {
+	parser := configs.NewParser(nil)
+	file, diags := parser.LoadConfigFile(path)
+	collectedDiagnostics.add(parser.Sources(), diags)
+
+	return file, diags
+}
+
+// In strict mode, prints all collected diagnostics with their source to `out` and fails if there are any.
+// Otherwise only logs how many were found
+func reportDiagnostics(out io.Writer) error {
+	collectedDiagnostics.lock.Lock()
+	defer collectedDiagnostics.lock.Unlock()
+
+	diags := collectedDiagnostics.diags
+	if len(diags) == 0 {
+		return nil
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, diag := range diags {
+		if diag.Severity == hcl.DiagError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+	}
+
+	if !strict {
+		log.Warnf("Found %d errors and %d warnings in Terraform files, which may have changed dependencies or locals. Run with --strict to see them", errorCount, warningCount)
+		return nil
+	}
+
+	writer := hcl.NewDiagnosticTextWriter(out, collectedDiagnostics.files, 100, false)
+	if err := writer.WriteDiagnostics(diags); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("found %d errors and %d warnings in Terraform files", errorCount, warningCount)
+}
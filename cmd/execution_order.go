@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/hashicorp/terraform/configs"
+	log "github.com/sirupsen/logrus"
+)
+
+// Pinned groups from locals are the lowest group a project can be in. Dependencies may still move it to a later group
+const lowerBoundPins = "lower-bound"
+
+// Pinned groups from locals are used as is. Dependencies contradicting them are an error
+const exactPins = "exact"
+
+// Finds the projects that a project depends on, from its `when_modified` entries pointing into other project dirs
+func projectDependencies(project *AtlantisProject, projectsMap map[string]*AtlantisProject) []*AtlantisProject {
+	dependencies := []*AtlantisProject{}
+	seen := map[string]bool{}
+	for _, dep := range project.Autoplan.WhenModified {
+		depPath := filepath.ToSlash(filepath.Dir(filepath.Join(project.Dir, dep)))
+		if depPath == project.Dir || seen[depPath] {
+			// skip dependency on oneself
+			continue
+		}
+
+		depProject, ok := projectsMap[depPath]
+		if !ok {
+			// skip not project dependencies
+			continue
+		}
+		seen[depPath] = true
+		dependencies = append(dependencies, depProject)
+	}
+
+	return dependencies
+}
+
+// Reads the group pinned in the locals, annotations or rules of a project kept from the old config without
+// generating it again, so recomputing the groups does not lose it
+func readExecutionOrderGroupPin(relativeDir string) *int {
+	dir := filepath.Join(gitRoot, relativeDir)
+	if !isConfigDir(dir) {
+		return nil
+	}
+
+	// Diagnostics of the module were already reported, if it was part of this run
+	module, _ := loadConfigDirFiles(configs.NewParser(nil), dir)
+	annotations, _ := resolveCommentAnnotations(dir)
+	locals := mergeLocals(resolveLocals(module), annotations)
+	if locals.ExecutionOrderGroup != nil {
+		return locals.ExecutionOrderGroup
+	}
+
+	rules, _ := resolveRules(relativeDir)
+	return rules.ExecutionOrderGroup
+}
+
+// Sets the execution_order_group of each project to run after all projects it depends on. Groups pinned in locals
+// are respected according to `--execution-order-group-pins`
+func computeExecutionOrderGroups(projects []AtlantisProject) error {
+	if executionOrderGroupPins != lowerBoundPins && executionOrderGroupPins != exactPins {
+		return fmt.Errorf("unknown --execution-order-group-pins mode %q, expected %q or %q", executionOrderGroupPins, lowerBoundPins, exactPins)
+	}
+
+	projectsMap := make(map[string]*AtlantisProject, len(projects))
+	for i := range projects {
+		projectsMap[projects[i].Dir] = &projects[i]
+	}
+
+	// Compute order groups in the cycle to avoid incorrect values in cascade dependencies
+	hasChanges := true
+	for iteration := 0; hasChanges && iteration <= len(projects); iteration++ {
+		hasChanges = false
+		for i := range projects {
+			project := &projects[i]
+
+			executionOrderGroup := 0
+			// choose order group based on dependencies
+			for _, depProject := range projectDependencies(project, projectsMap) {
+				if depProject.ExecutionOrderGroup+1 > executionOrderGroup {
+					executionOrderGroup = depProject.ExecutionOrderGroup + 1
+				}
+			}
+
+			if pin := project.executionOrderGroupPin; pin != nil {
+				if executionOrderGroupPins == exactPins || *pin > executionOrderGroup {
+					executionOrderGroup = *pin
+				}
+			}
+
+			if project.ExecutionOrderGroup != executionOrderGroup {
+				project.ExecutionOrderGroup = executionOrderGroup
+				// repeat the main cycle when changed some project
+				hasChanges = true
+			}
+		}
+	}
+
+	if hasChanges {
+		// Should be unreachable
+		log.Warn("Computing execution_order_groups failed. Probably cycle exists")
+	}
+
+	// Exact pins are not moved by the computation above, so check they still run after their dependencies
+	for i := range projects {
+		project := &projects[i]
+		for _, depProject := range projectDependencies(project, projectsMap) {
+			if depProject.ExecutionOrderGroup < project.ExecutionOrderGroup {
+				continue
+			}
+			if project.executionOrderGroupPin != nil || depProject.executionOrderGroupPin != nil {
+				return fmt.Errorf("pinned execution_order_group of %s (%d) contradicts its dependency on %s (%d), which must run in an earlier group",
+					project.Dir, project.ExecutionOrderGroup, depProject.Dir, depProject.ExecutionOrderGroup)
+			}
+		}
+	}
+
+	return nil
+}
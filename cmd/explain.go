@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// Everything the explain command prints about a project
+type projectExplanation struct {
+	settings []settingExplanation
+
+	// Dependencies before they were normalized, with paths relative to the project dir as in `when_modified`
+	dependencies []dependency
+}
+
+// The resolved value of a project setting and where it comes from
+type settingExplanation struct {
+	name   string
+	value  string
+	origin string
+}
+
+// Records a setting. Does nothing on a nil explanation, so the generator does not need to check
+func (e *projectExplanation) addSetting(name string, value interface{}, origin string) {
+	if e == nil {
+		return
+	}
+
+	formatted := fmt.Sprint(value)
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			formatted = "(not set)"
+		}
+	case []string:
+		formatted = "[" + strings.Join(v, ", ") + "]"
+	}
+
+	e.settings = append(e.settings, settingExplanation{name: name, value: formatted, origin: origin})
+}
+
+// Records a `when_modified` entry before normalization. Does nothing on a nil explanation
+func (e *projectExplanation) addDependency(dep dependency) {
+	if e == nil {
+		return
+	}
+
+	e.dependencies = append(e.dependencies, dep)
+}
+
+// Records `origin` for every setting the locals set
+func recordLocalsOrigins(origins map[string]string, locals ResolvedLocals, origin string) {
+	set := map[string]bool{
+		"skip":                  locals.Skip != nil,
+		"autoplan":              locals.AutoPlan != nil,
+		"workflow":              locals.AtlantisWorkflow != "",
+		"apply_requirements":    locals.ApplyRequirements != nil,
+		"terraform_version":     locals.TerraformVersion != "",
+		"tofu_version":          locals.TofuVersion != "",
+		"project_type":          locals.ProjectType != "",
+		"execution_order_group": locals.ExecutionOrderGroup != nil,
+		"autoplan_file_list":    locals.AutoPlanFileList != nil,
+		"when_modified_exclude": locals.WhenModifiedExclude != nil,
+	}
+	for name, isSet := range set {
+		if isSet {
+			origins[name] = origin
+		}
+	}
+}
+
+// Checks if a `when_modified` entry found by the generator ended up in `entry` after normalization,
+// either unchanged or covered by a broader glob
+func coversEntry(entry string, raw string) bool {
+	if strings.HasPrefix(entry, "!") != strings.HasPrefix(raw, "!") {
+		return false
+	}
+	entry = strings.TrimPrefix(entry, "!")
+	raw = path.Clean(strings.TrimPrefix(raw, "!"))
+
+	return entry == raw || (isGlob(entry) && matchPattern(entry, raw))
+}
+
+func formatDependency(dep dependency) string {
+	if dep.source.Filename == "" {
+		return dep.detail
+	}
+
+	return fmt.Sprintf("%s (%s)", dep.detail, relativeRange(dep.source))
+}
+
+func printExplanation(out io.Writer, project *AtlantisProject, explanation *projectExplanation) error {
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(writer, "Settings:")
+	for _, setting := range explanation.settings {
+		fmt.Fprintf(writer, "  %s\t%s\t%s\n", setting.name, setting.value, setting.origin)
+	}
+
+	if project == nil {
+		fmt.Fprintln(writer, "Skipped, no project is generated")
+		return writer.Flush()
+	}
+
+	fmt.Fprintln(writer, "when_modified:")
+	for _, entry := range project.Autoplan.WhenModified {
+		first := true
+		for _, dep := range explanation.dependencies {
+			if !coversEntry(entry, dep.path) {
+				continue
+			}
+			column := ""
+			if first {
+				column = entry
+			}
+			first = false
+
+			// Entries dropped for a broader glob are listed under it with their own path
+			found := dep.mechanism
+			if path.Clean(strings.TrimPrefix(dep.path, "!")) != strings.TrimPrefix(entry, "!") {
+				found = fmt.Sprintf("%s, covering %s", dep.mechanism, dep.path)
+			}
+			fmt.Fprintf(writer, "  %s\t%s\t%s\n", column, found, formatDependency(dep))
+		}
+	}
+
+	return writer.Flush()
+}
+
+func explainProject(cmd *cobra.Command, args []string) error {
+	if err := resolveGitRoot(); err != nil {
+		return err
+	}
+	if err := loadProjectRules(); err != nil {
+		return err
+	}
+
+	dir := args[0]
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(gitRoot, dir)
+	}
+	dir = filepath.Clean(dir)
+
+	relativeDir, ok := relativeToGitRoot(dir)
+	if !ok {
+		return fmt.Errorf("%s is outside of the repo", args[0])
+	}
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Project: %s\n", relativeDir)
+
+	// Walked directories below an excluded one are never looked at, so check all of the ancestors too
+	filter := newDirectoryFilter()
+	for current := dir; ; current = filepath.Dir(current) {
+		if filter.isExcluded(current) {
+			fmt.Fprintf(out, "Excluded, as %s is excluded by --exclude or an %s file\n", relativeFile(current), atlantisIgnoreFileName)
+			return nil
+		}
+		if filepath.Clean(current) == filepath.Clean(gitRoot) || filepath.Dir(current) == current {
+			break
+		}
+	}
+	if !filter.isIncluded(dir) {
+		fmt.Fprintln(out, "Excluded, as it does not match any --include pattern")
+		return nil
+	}
+
+	module, _ := loadConfigDir(dir)
+	if module == nil || module.Backend == nil {
+		return fmt.Errorf("%s is not a root module, as it has no backend block", relativeDir)
+	}
+
+	explanation := &projectExplanation{}
+	project, err := resolveProject(dir, explanation)
+	if err != nil {
+		return err
+	}
+
+	return printExplanation(out, project, explanation)
+}
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain <dir>",
+	Short: "Shows why a project has its settings and dependencies",
+	Long:  `Prints the settings and 'when_modified' entries generated for the root module in <dir>, relative to --root, and where each of them comes from. Takes the same flags as generate`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  explainProject,
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+
+	addGenerateFlags(explainCmd.Flags())
+}
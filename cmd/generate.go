@@ -1,14 +1,18 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/terraform/configs"
 	"regexp"
 	"sort"
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
@@ -23,18 +27,89 @@ import (
 	"sync"
 )
 
-// Terragrunt imports can be relative or absolute
+// Dependencies can be relative, absolute or relative to the repo root when starting with `//`
 // This makes relative paths absolute
 func makePathAbsolute(path string, parentPath string) string {
 	if strings.HasPrefix(path, filepath.ToSlash(gitRoot)) {
 		return path
 	}
 
+	if strings.HasPrefix(path, repoRootPrefix) {
+		return filepath.Join(gitRoot, strings.TrimPrefix(path, repoRootPrefix))
+	}
+
 	return filepath.Join(parentPath, path)
 }
 
+// Makes a dependency path absolute, unless it already is
+func absoluteDependencyPath(path string, parentPath string) string {
+	// `//` paths are absolute on Unix, but here they are relative to the repo root
+	if filepath.IsAbs(path) && !strings.HasPrefix(path, repoRootPrefix) {
+		return path
+	}
+
+	return makePathAbsolute(path, parentPath)
+}
+
+// Finds where the extra dependencies of a module are set: the `atlantis` local, which wins, or an annotation comment
+func extraDependenciesSource(module *configs.Module) *hcl.Range {
+	if local, ok := module.Locals["atlantis"]; ok && resolveLocals(module).ExtraAtlantisDependencies != nil {
+		return local.DeclRange.Ptr()
+	}
+	_, ranges := resolveCommentAnnotations(module.SourceDir)
+	if annotation, ok := ranges["extra_dependencies"]; ok {
+		return annotation.Ptr()
+	}
+
+	return nil
+}
+
+// Warns about extra dependencies which resolve outside the repo or do not match any file, recording
+// a diagnostic on `source` for each of them
+func checkExtraDependencies(module *configs.Module, dependencies []string, source *hcl.Range) {
+	warn := func(format string, args ...interface{}) {
+		log.Warnf(format, args...)
+		collectedDiagnostics.add(nil, hcl.Diagnostics{{
+			Severity: hcl.DiagWarning,
+			Summary:  "Invalid extra dependency",
+			Detail:   fmt.Sprintf(format, args...),
+			Subject:  source,
+		}})
+	}
+
+	for _, dep := range dependencies {
+		absolutePath := absoluteDependencyPath(dep, module.SourceDir)
+
+		if _, ok := relativeToGitRoot(absolutePath); !ok {
+			warn("Extra dependency %q of %s resolves outside the repo", dep, module.SourceDir)
+			continue
+		}
+
+		matches, err := doublestar.Glob(absolutePath)
+		if err != nil {
+			warn("Extra dependency %q of %s is not a valid glob: %s", dep, module.SourceDir, err)
+			continue
+		}
+		if len(matches) == 0 {
+			warn("Extra dependency %q of %s does not match any file", dep, module.SourceDir)
+		}
+	}
+}
+
+// Prefix of dependency paths relative to the repo root, e.g. `//shared/versions.tf`
+const repoRootPrefix = "//"
+
 var requestGroup singleflight.Group
 
+// Logs why the generator made a decision. Only visible at debug level, unless `--log-decisions` is set
+func explainf(format string, args ...interface{}) {
+	if logDecisions {
+		log.Infof(format, args...)
+	} else {
+		log.Debugf(format, args...)
+	}
+}
+
 func uniqueStrings(str []string) []string {
 	keys := make(map[string]bool)
 	list := []string{}
@@ -63,64 +138,179 @@ func sliceUnion(a, b []string) []string {
 	return a
 }
 
-// Parses the terragrunt config at `path` to find all modules it depends on
-func getDependencies(module *configs.Module, locals ResolvedLocals) ([]string, error) {
+// Parses the terragrunt config at `path` to find all modules it depends on. Local modules are watched for `moduleFiles`
+func getDependencies(module *configs.Module, locals ResolvedLocals, moduleFiles []string) ([]dependency, error) {
 	res, err, _ := requestGroup.Do(module.SourceDir, func() (interface{}, error) {
 
-		dependencies := []string{}
+		dependencies := []dependency{}
 		// Get deps from locals
 		if locals.ExtraAtlantisDependencies != nil {
-			dependencies = sliceUnion(dependencies, locals.ExtraAtlantisDependencies)
+			subject := extraDependenciesSource(module)
+			checkExtraDependencies(module, locals.ExtraAtlantisDependencies, subject)
+			var source hcl.Range
+			if subject != nil {
+				source = *subject
+			}
+			for _, dep := range uniqueStrings(locals.ExtraAtlantisDependencies) {
+				dependencies = append(dependencies, dependency{
+					path:      dep,
+					mechanism: mechanismExtraDependency,
+					detail:    "atlantis.extra_dependencies",
+					source:    source,
+				})
+			}
 		}
 
 		// Get deps from locally used modules
 		if !ignoreLocalSubModules {
-			ls, err := parseTerraformLocalModuleSource(module)
+			ls, err := parseTerraformLocalModuleSource(module, moduleFiles)
 			if err != nil {
 				return nil, err
 			}
-			sort.Strings(ls)
 
 			dependencies = append(dependencies, ls...)
 		}
 
+		// Both scanners below evaluate expressions of the project and all of its local sub modules
+		var staticModules []staticModule
+		if !ignoreFileFunctions || !ignorePathAttributes {
+			staticModules = loadStaticModules(module)
+		}
+
+		// Get deps from files read by file(), templatefile() and friends
+		if !ignoreFileFunctions {
+			fs, err := parseTerraformFileFunctions(module, staticModules)
+			if err != nil {
+				return nil, err
+			}
+
+			dependencies = append(dependencies, fs...)
+		}
+
+		// Get deps from attributes of resources known to read local paths, like `archive_file.source_dir`
+		if !ignorePathAttributes {
+			ps, err := parseTerraformPathAttributes(module, staticModules)
+			if err != nil {
+				return nil, err
+			}
+
+			dependencies = append(dependencies, ps...)
+		}
+
 		// Filter out and dependencies that are the empty string
-		nonEmptyDeps := []string{}
+		nonEmptyDeps := []dependency{}
 		for _, dep := range dependencies {
-			if dep != "" {
-				childDepAbsPath := dep
-				if !filepath.IsAbs(childDepAbsPath) {
-					childDepAbsPath = makePathAbsolute(dep, module.SourceDir)
-				}
-				childDepAbsPath = filepath.ToSlash(childDepAbsPath)
-				nonEmptyDeps = append(nonEmptyDeps, childDepAbsPath)
+			if dep.path != "" {
+				nonEmptyDeps = append(nonEmptyDeps, dep)
 			}
 		}
-		return dependencies, nil
+		return nonEmptyDeps, nil
 	})
 
 	if res != nil {
-		return res.([]string), err
+		return res.([]dependency), err
 	} else {
 		return nil, err
 	}
 }
 
+// Cleans up the path of a root module to the relative format Atlantis expects for a project dir
+func relativeProjectDir(path string) string {
+	relativeSourceDir := strings.TrimPrefix(path+string(filepath.Separator), gitRoot)
+	relativeSourceDir = strings.TrimSuffix(relativeSourceDir, string(filepath.Separator))
+	if relativeSourceDir == "" {
+		relativeSourceDir = "."
+	}
+
+	return filepath.ToSlash(relativeSourceDir)
+}
+
 // Creates an AtlantisProject for a directory
 func createProject(path string) (*AtlantisProject, error) {
+	return resolveProject(path, nil)
+}
+
+// Creates an AtlantisProject for a directory. Unless `explanation` is nil, records in it where each setting
+// and dependency of the project comes from
+func resolveProject(path string, explanation *projectExplanation) (*AtlantisProject, error) {
 	// Errors here are only warnings that we can live with. All these modules have already been loaded in dir walk phase
-	rootModule, _ := configs.NewParser(nil).LoadConfigDir(path)
+	rootModule, _ := loadConfigDir(path)
 
 	absoluteSourceDir := rootModule.SourceDir + string(filepath.Separator)
 
-	locals := resolveLocals(rootModule)
+	moduleLocals := resolveLocals(rootModule)
+	annotations, annotationRanges := resolveCommentAnnotations(rootModule.SourceDir)
+	locals := mergeLocals(moduleLocals, annotations)
+
+	// Which layer each setting comes from: the module itself, an ancestor directory or a rule of the config file.
+	// In the module, the atlantis local wins over annotation comments
+	origins := map[string]string{}
+	annotationOrigins := map[string]string{}
+	recordLocalsOrigins(annotationOrigins, annotations, "")
+	for name := range annotationOrigins {
+		origins[name] = fmt.Sprintf("atlantis comment (%s)", relativeRange(annotationRanges[name]))
+	}
+	if local, ok := rootModule.Locals["atlantis"]; ok {
+		recordLocalsOrigins(origins, moduleLocals, fmt.Sprintf("atlantis local (%s)", relativeRange(local.DeclRange)))
+	}
+
+	// Skip and autoplan cascade down from ancestor directories, unless set on the module itself
+	inherited := resolveInheritedLocals(rootModule.SourceDir)
+	if locals.Skip == nil && inherited.Skip != nil {
+		locals.Skip = inherited.Skip
+		origins["skip"] = "inherited from " + relativeFile(inherited.SkipSource)
+		explainf("%s inherits atlantis.skip = %t from %s", path, *inherited.Skip, inherited.SkipSource)
+	}
+	if locals.AutoPlan == nil && inherited.AutoPlan != nil {
+		locals.AutoPlan = inherited.AutoPlan
+		origins["autoplan"] = "inherited from " + relativeFile(inherited.AutoPlanSource)
+		explainf("%s inherits atlantis.autoplan = %t from %s", path, *inherited.AutoPlan, inherited.AutoPlanSource)
+	}
+
+	// Rules of the config file apply to everything that neither the module nor its ancestors set
+	rules, ruleOrigins := resolveRules(relativeProjectDir(rootModule.SourceDir))
+	if locals.AutoPlan == nil && rules.AutoPlan != nil {
+		locals.AutoPlan = rules.AutoPlan
+		origins["autoplan"] = ruleOrigins["autoplan"]
+	}
+	if locals.AtlantisWorkflow == "" && rules.AtlantisWorkflow != "" {
+		locals.AtlantisWorkflow = rules.AtlantisWorkflow
+		origins["workflow"] = ruleOrigins["workflow"]
+	}
+	if locals.ApplyRequirements == nil && rules.ApplyRequirements != nil {
+		locals.ApplyRequirements = rules.ApplyRequirements
+		origins["apply_requirements"] = ruleOrigins["apply_requirements"]
+	}
+	if locals.ProjectType == "" && rules.ProjectType != "" {
+		locals.ProjectType = rules.ProjectType
+		origins["project_type"] = ruleOrigins["project_type"]
+	}
+	if locals.ExecutionOrderGroup == nil && rules.ExecutionOrderGroup != nil {
+		locals.ExecutionOrderGroup = rules.ExecutionOrderGroup
+		origins["execution_order_group"] = ruleOrigins["execution_order_group"]
+	}
 
 	// If `atlantis_skip` is true on the module, then do not produce a project for it
 	if locals.Skip != nil && *locals.Skip {
+		explanation.addSetting("skip", "true", origins["skip"])
+		explainf("Skipped project for %s", path)
 		return nil, nil
 	}
 
-	dependencies, err := getDependencies(rootModule, locals)
+	// The module-local files triggering a plan come from the locals, then the project type set by locals or rules,
+	// then the `--autoplan-file-list` flag and last the `--project-type` flag
+	projectType, projectTypeOrigin := defaultProjectType, "--project-type flag"
+	if locals.ProjectType != "" {
+		projectType, projectTypeOrigin = locals.ProjectType, origins["project_type"]
+	}
+
+	// Local modules the project calls are watched for the files of its project type
+	projectTypeFiles, err := resolveProjectTypeFiles(projectType, projectTypes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", relativeProjectDir(rootModule.SourceDir), err)
+	}
+
+	dependencies, err := getDependencies(rootModule, locals, subModuleFiles(projectTypeFiles))
 	if err != nil {
 		return nil, err
 	}
@@ -130,66 +320,120 @@ func createProject(path string) (*AtlantisProject, error) {
 		return nil, nil
 	}
 
-	// All dependencies depend on their own .hcl file, and any tf files in their directory
-	relativeDependencies := autoPlanFileList
+	var fileList []string
+	var fileListOrigin string
+	switch {
+	case locals.AutoPlanFileList != nil:
+		fileList, fileListOrigin = locals.AutoPlanFileList, origins["autoplan_file_list"]
+	case locals.ProjectType == "" && len(autoPlanFileList) > 0:
+		fileList, fileListOrigin = autoPlanFileList, "--autoplan-file-list flag"
+	default:
+		fileList = projectTypeFiles
+		fileListOrigin = fmt.Sprintf("project type %s", projectType)
+		explanation.addSetting("project_type", projectType, projectTypeOrigin)
+	}
+	relativeDependencies := []dependency{}
+	for _, pattern := range fileList {
+		relativeDependencies = append(relativeDependencies, dependency{path: pattern, mechanism: mechanismAutoPlanFileList, detail: fileListOrigin})
+	}
 
 	// Add other dependencies based on their relative paths. We always want to output with Unix path separators
-	for _, dependencyPath := range dependencies {
-		absolutePath := dependencyPath
-		if !filepath.IsAbs(absolutePath) {
-			absolutePath = makePathAbsolute(dependencyPath, rootModule.SourceDir)
-		}
+	for _, dep := range dependencies {
+		absolutePath := absoluteDependencyPath(dep.path, rootModule.SourceDir)
 		relativePath, err := filepath.Rel(absoluteSourceDir, absolutePath)
 		if err != nil {
 			return nil, err
 		}
 
-		relativeDependencies = append(relativeDependencies, filepath.ToSlash(relativePath))
+		dep.path = filepath.ToSlash(relativePath)
+		relativeDependencies = append(relativeDependencies, dep)
 	}
 
-	// Clean up the relative path to the format Atlantis expects
-	relativeSourceDir := strings.TrimPrefix(absoluteSourceDir, gitRoot)
-	relativeSourceDir = strings.TrimSuffix(relativeSourceDir, string(filepath.Separator))
-	if relativeSourceDir == "" {
-		relativeSourceDir = "."
+	// Exclusions must come last, as Atlantis lets later patterns override earlier ones
+	excludes, excludesOrigin := whenModifiedExclude, "--when-modified-exclude flag"
+	if locals.WhenModifiedExclude != nil {
+		excludes, excludesOrigin = locals.WhenModifiedExclude, origins["when_modified_exclude"]
 	}
+	if len(excludes) > 0 {
+		excludedDirs := []string{"."}
+		if !ignoreLocalSubModules {
+			for _, subModuleDir := range localSubModuleDirs(rootModule) {
+				relativePath, err := filepath.Rel(rootModule.SourceDir, subModuleDir)
+				if err != nil {
+					return nil, err
+				}
+				excludedDirs = append(excludedDirs, relativePath)
+			}
+		}
+
+		for _, dir := range excludedDirs {
+			for _, pattern := range excludes {
+				relativeDependencies = append(relativeDependencies, dependency{
+					path:      "!" + joinPath(dir, strings.TrimPrefix(pattern, "!")),
+					mechanism: mechanismWhenModifiedExclude,
+					detail:    excludesOrigin,
+				})
+			}
+		}
+	}
+
+	whenModified := []string{}
+	for _, dep := range relativeDependencies {
+		whenModified = append(whenModified, dep.path)
+		explanation.addDependency(dep)
+	}
+
+	relativeSourceDir := relativeProjectDir(rootModule.SourceDir)
 
-	workflow := defaultWorkflow
+	workflow, workflowOrigin := defaultWorkflow, "--workflow flag"
 	if locals.AtlantisWorkflow != "" {
-		workflow = locals.AtlantisWorkflow
+		workflow, workflowOrigin = locals.AtlantisWorkflow, origins["workflow"]
 	}
 
-	applyRequirements := &defaultApplyRequirements
+	applyRequirements, applyRequirementsOrigin := &defaultApplyRequirements, "--apply-requirements flag"
 	if len(defaultApplyRequirements) == 0 {
 		applyRequirements = nil
 	}
 	if locals.ApplyRequirements != nil {
-		applyRequirements = &locals.ApplyRequirements
+		applyRequirements, applyRequirementsOrigin = &locals.ApplyRequirements, origins["apply_requirements"]
 	}
 
-	resolvedAutoPlan := autoPlan
+	resolvedAutoPlan, autoPlanOrigin := autoPlan, "--autoplan flag"
 	if locals.AutoPlan != nil {
-		resolvedAutoPlan = *locals.AutoPlan
+		resolvedAutoPlan, autoPlanOrigin = *locals.AutoPlan, origins["autoplan"]
 	}
 
-	terraformVersion := defaultTerraformVersion
-	if locals.TerraformVersion != "" {
-		terraformVersion = locals.TerraformVersion
+	terraformVersion, distribution, terraformVersionOrigin, err := resolveVersionPin(locals, origins)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", relativeProjectDir(rootModule.SourceDir), err)
 	}
 
 	project := &AtlantisProject{
-		Dir:               filepath.ToSlash(relativeSourceDir),
-		Workflow:          workflow,
-		TerraformVersion:  terraformVersion,
-		ApplyRequirements: applyRequirements,
+		Dir:                   filepath.ToSlash(relativeSourceDir),
+		Workflow:              workflow,
+		TerraformVersion:      terraformVersion,
+		TerraformDistribution: distribution,
+		ApplyRequirements:     applyRequirements,
 		Autoplan: AutoplanConfig{
 			Enabled:      resolvedAutoPlan,
-			WhenModified: uniqueStrings(relativeDependencies),
+			WhenModified: normalizeWhenModified(whenModified),
 		},
 	}
 
-	if locals.ExecutionOrderGroup > 0 {
-		project.ExecutionOrderGroup = locals.ExecutionOrderGroup
+	explanation.addSetting("autoplan", resolvedAutoPlan, autoPlanOrigin)
+	explanation.addSetting("workflow", workflow, workflowOrigin)
+	if applyRequirements != nil {
+		explanation.addSetting("apply_requirements", *applyRequirements, applyRequirementsOrigin)
+	}
+	explanation.addSetting("terraform_version", terraformVersion, terraformVersionOrigin)
+	if distribution != "" {
+		explanation.addSetting("terraform_distribution", distribution, terraformVersionOrigin)
+	}
+
+	if locals.ExecutionOrderGroup != nil {
+		project.ExecutionOrderGroup = *locals.ExecutionOrderGroup
+		project.executionOrderGroupPin = locals.ExecutionOrderGroup
+		explanation.addSetting("execution_order_group", *locals.ExecutionOrderGroup, origins["execution_order_group"])
 	}
 
 	// Terraform Cloud limits the workspace names to be less than 90 characters
@@ -203,10 +447,12 @@ func createProject(path string) (*AtlantisProject, error) {
 
 	if createProjectName {
 		project.Name = projectName
+		explanation.addSetting("name", projectName, "--create-project-name flag")
 	}
 
 	if createWorkspace {
 		project.Workspace = projectName
+		explanation.addSetting("workspace", projectName, "--create-workspace flag")
 	}
 
 	return project, nil
@@ -214,6 +460,7 @@ func createProject(path string) (*AtlantisProject, error) {
 
 func FindRootModulesInPath(rootPath string) ([]string, error) {
 	var rootModules []string
+	filter := newDirectoryFilter()
 
 	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
 		// Skip .terraform and .git dirs
@@ -221,9 +468,14 @@ func FindRootModulesInPath(rootPath string) ([]string, error) {
 			return filepath.SkipDir
 		}
 
-		if info.IsDir() {
+		// Skip dirs excluded by flags or .atlantisignore files
+		if info.IsDir() && filter.isExcluded(path) {
+			return filepath.SkipDir
+		}
+
+		if info.IsDir() && filter.isIncluded(path) {
 
-			module, diag := configs.NewParser(nil).LoadConfigDir(path)
+			module, diag := loadConfigDir(path)
 			if diag.HasErrors() && module.Backend == nil {
 				log.Debugf("Failed to load module at: %s", path)
 				return nil
@@ -286,19 +538,64 @@ func getAllTerraformRootModules(path string) ([]string, error) {
 }
 
 func main(cmd *cobra.Command, args []string) error {
-	// Ensure the gitRoot has a trailing slash and is an absolute path
-	absoluteGitRoot, err := filepath.Abs(gitRoot)
-	if err != nil {
+	// As a pre workflow hook, the repo and the pull request are described by the environment Atlantis sets
+	var hookEnv hookEnvironment
+	if hookAffectedOnly && !hookMode {
+		return fmt.Errorf("--hook-affected-only needs --hook")
+	}
+	if hookMode {
+		env, err := readHookEnvironment()
+		if err != nil {
+			return err
+		}
+		hookEnv = env
+		defer applyHookEnvironment(cmd, hookEnv)()
+	}
+
+	if err := resolveGitRoot(); err != nil {
 		return err
 	}
-	gitRoot = absoluteGitRoot + string(filepath.Separator)
+
+	// Files changed by the pull request, or nil to generate all projects
+	var changedFiles []string
+	if hookMode && hookAffectedOnly {
+		files, err := hookEnv.changedFiles()
+		if err != nil {
+			return err
+		}
+		changedFiles = files
+	}
 	workingDirs := []string{gitRoot}
 
+	if err := loadProjectRules(); err != nil {
+		return err
+	}
+
 	// Read in the old config, if it already exists
 	oldConfig, err := readOldConfig()
 	if err != nil {
 		return err
 	}
+	oldDocument, err := readOldDocument()
+	if err != nil {
+		return err
+	}
+
+	// With --since, only the root modules affected by changes since the ref are regenerated, and the old projects
+	// of all others are kept as they are
+	var impact *impactFilter
+	if sinceRef != "" {
+		if oldConfig == nil {
+			log.Warnf("Generating all projects despite --since %s, as there is no old config to keep projects from", sinceRef)
+		} else {
+			files, err := changedFilesBetween(sinceRef, "")
+			if err != nil {
+				return err
+			}
+			impact = newImpactFilter(oldConfig, files)
+		}
+	}
+	keepOldProjects := preserveProjects || impact != nil
 	config := AtlantisConfig{
 		Version:       3,
 		AutoMerge:     autoMerge,
@@ -308,10 +605,24 @@ func main(cmd *cobra.Command, args []string) error {
 	if oldConfig != nil && preserveWorkflows {
 		config.Workflows = oldConfig.Workflows
 	}
-	if oldConfig != nil && preserveProjects {
+	if oldConfig != nil && keepOldProjects {
 		config.Projects = oldConfig.Projects
 	}
 
+	// In merge mode, existing projects are merged field by field instead of being replaced
+	oldProjects := map[string]oldProject{}
+	annotations := map[string]*projectAnnotation{}
+	if oldConfig != nil && keepOldProjects && mergeProjects {
+		oldProjects = readOldProjects(oldDocument)
+	}
+
+	// Relative dirs of the root modules found and the projects generated in this run, to prune stale projects
+	visitedDirs := map[string]bool{}
+	generatedDirs := map[string]bool{}
+
+	// Relative dirs of the root modules whose old projects --since kept without regenerating them
+	keptDirs := map[string]bool{}
+
 	lock := sync.Mutex{}
 	ctx := context.Background()
 	errGroup, _ := errgroup.WithContext(ctx)
@@ -326,6 +637,13 @@ func main(cmd *cobra.Command, args []string) error {
 		// Concurrently looking all dependencies
 		for _, rootModule := range terraformRootModules {
 			modulePath := rootModule // https://golang.org/doc/faq#closures_and_goroutines
+			visitedDirs[relativeProjectDir(modulePath)] = true
+
+			if impact != nil && !impact.isImpacted(modulePath) {
+				log.Debugf("Kept the old project for %s, as nothing it depends on changed since %s", modulePath, sinceRef)
+				keptDirs[relativeProjectDir(modulePath)] = true
+				continue
+			}
 
 			err := sem.Acquire(ctx, 1)
 			if err != nil {
@@ -346,18 +664,40 @@ func main(cmd *cobra.Command, args []string) error {
 				// Lock the list as only one goroutine should be writing to config.Projects at a time
 				lock.Lock()
 				defer lock.Unlock()
+				generatedDirs[project.Dir] = true
+
+				// Projects the pull request does not affect are left out, while pruning keeps their old entries
+				if changedFiles != nil && len(matchingChangedFiles(project, modulePath, changedFiles)) == 0 {
+					log.Debugf("Left out project for %s, as no changed file affects it", modulePath)
+					return nil
+				}
 
 				// When preserving existing projects, we should update existing blocks instead of creating a
 				// duplicate, when generating something which already has representation
-				if preserveProjects {
+				if keepOldProjects {
 					updateProject := false
 
 					// TODO: with Go 1.19, we can replace for loop with slices.IndexFunc for increased performance
 					for i := range config.Projects {
 						if config.Projects[i].Dir == project.Dir {
 							updateProject = true
-							log.Info("Updated project for ", modulePath)
-							config.Projects[i] = *project
+
+							if !mergeProjects {
+								log.Info("Updated project for ", modulePath)
+								config.Projects[i] = *project
+								break
+							}
+
+							old := oldProjects[project.Dir]
+							if old.unmanaged {
+								log.Info("Left unmanaged project untouched for ", modulePath)
+								annotations[project.Dir] = &projectAnnotation{node: old.node}
+								break
+							}
+
+							log.Info("Merged project for ", modulePath)
+							annotations[project.Dir] = &projectAnnotation{generated: project}
+							config.Projects[i] = mergeProject(config.Projects[i], *project, old)
 
 							// projects should be unique, let's exit for loop for performance
 							// once first occurrence is found and replaced
@@ -368,6 +708,9 @@ func main(cmd *cobra.Command, args []string) error {
 					if !updateProject {
 						log.Info("Created project for ", modulePath)
 						config.Projects = append(config.Projects, *project)
+						if mergeProjects {
+							annotations[project.Dir] = &projectAnnotation{generated: project}
+						}
 					}
 				} else {
 					log.Info("Created project for ", modulePath)
@@ -383,49 +726,30 @@ func main(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if err := reportDiagnostics(cmd.ErrOrStderr()); err != nil {
+		return err
+	}
+
+	for dir := range keptDirs {
+		generatedDirs[dir] = true
+	}
+	if keepOldProjects && pruneProjects {
+		config.Projects = pruneStaleProjects(config.Projects, generatedDirs, visitedDirs, oldProjects)
+	}
+
 	// Sort the projects in config by Dir
 	sort.Slice(config.Projects, func(i, j int) bool { return config.Projects[i].Dir < config.Projects[j].Dir })
 
 	if executionOrderGroups {
-		projectsMap := make(map[string]*AtlantisProject, len(config.Projects))
+		// Only projects generated in this run know their pins
 		for i := range config.Projects {
-			projectsMap[config.Projects[i].Dir] = &config.Projects[i]
-		}
-
-		// Compute order groups in the cycle to avoid incorrect values in cascade dependencies
-		hasChanges := true
-		for i := 0; hasChanges && i <= len(config.Projects); i++ {
-			hasChanges = false
-			for _, project := range config.Projects {
-				executionOrderGroup := 0
-				// choose order group based on dependencies
-				for _, dep := range project.Autoplan.WhenModified {
-					depPath := filepath.Dir(filepath.Join(project.Dir, dep))
-					if depPath == project.Dir {
-						// skip dependency on oneself
-						continue
-					}
-
-					depProject, ok := projectsMap[depPath]
-					if !ok {
-						// skip not project dependencies
-						continue
-					}
-					if depProject.ExecutionOrderGroup+1 > executionOrderGroup {
-						executionOrderGroup = depProject.ExecutionOrderGroup + 1
-					}
-				}
-				if projectsMap[project.Dir].ExecutionOrderGroup != executionOrderGroup {
-					projectsMap[project.Dir].ExecutionOrderGroup = executionOrderGroup
-					// repeat the main cycle when changed some project
-					hasChanges = true
-				}
+			if keepOldProjects && config.Projects[i].executionOrderGroupPin == nil {
+				config.Projects[i].executionOrderGroupPin = readExecutionOrderGroupPin(config.Projects[i].Dir)
 			}
 		}
 
-		if hasChanges {
-			// Should be unreachable
-			log.Warn("Computing execution_order_groups failed. Probably cycle exists")
+		if err := computeExecutionOrderGroups(config.Projects); err != nil {
+			return err
 		}
 
 		// Sort by execution_order_group
@@ -437,47 +761,84 @@ func main(cmd *cobra.Command, args []string) error {
 		})
 	}
 
+	if mergeProjects {
+		// Projects which were not regenerated in this run are kept exactly as they were
+		for dir, old := range oldProjects {
+			if _, ok := annotations[dir]; !ok {
+				annotations[dir] = &projectAnnotation{node: old.node}
+			}
+		}
+	}
+
 	// Convert config to YAML string
-	yamlBytes, err := yaml.Marshal(&config)
+	yamlBytes, err := renderConfig(&config, oldDocument, annotations, generatedHeader(cmd))
 	if err != nil {
 		return err
 	}
 
-	// Ensure newline characters are correct on windows machines, as the json encoding function in the stdlib
-	// uses "\n" for all newlines regardless of OS: https://github.com/golang/go/blob/master/src/encoding/json/stream.go#L211-L217
+	// Ensure newline characters are correct on windows machines, as the YAML encoder
+	// uses "\n" for all newlines regardless of OS
 	yamlString := string(yamlBytes)
 	if strings.Contains(runtime.GOOS, "windows") {
 		yamlString = strings.ReplaceAll(yamlString, "\n", "\r\n")
 	}
 
 	// Write output
-	if len(outputPath) != 0 {
+	if len(outputPath) != 0 && dryRun {
+		log.Infof("Dry run, not writing %s", outputPath)
+	} else if len(outputPath) != 0 {
 		ioutil.WriteFile(outputPath, []byte(yamlString), 0644)
 	} else {
 		log.Println(yamlString)
 	}
 
+	if hookMode {
+		printHookSummary(cmd, hookEnv, len(config.Projects), changedFiles)
+	}
+
 	return nil
 }
 
 var gitRoot string
 var autoPlan bool
 var autoPlanFileList []string
+var defaultProjectType string
 var autoMerge bool
 var ignoreLocalSubModules bool
+var ignoreFileFunctions bool
+var ignorePathAttributes bool
+var extraPathAttributes []string
 var localSubModulesExclude []string
+var whenModifiedExclude []string
+var collapseWhenModifiedThreshold int
+var repoURLs []string
 var parallel bool
 var createWorkspace bool
 var createProjectName bool
 var defaultTerraformVersion string
+var defaultTofuVersion string
 var defaultWorkflow string
 var filterPath string
+var includePatterns []string
+var excludePatterns []string
 var outputPath string
+var configPath string
 var preserveWorkflows bool
 var preserveProjects bool
+var mergeProjects bool
+var pruneProjects bool
+var dryRun bool
 var defaultApplyRequirements []string
 var numExecutors int64
 var executionOrderGroups bool
+var executionOrderGroupPins string
+var logDecisions bool
+var strict bool
+var headerComment string
+var keepComments bool
+var hookMode bool
+var hookAffectedOnly bool
+var sinceRef string
 
 // generateCmd represents the generate command
 var generateCmd = &cobra.Command{
@@ -490,28 +851,55 @@ var generateCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(generateCmd)
 
+	addGenerateFlags(generateCmd.PersistentFlags())
+	generateCmd.PersistentFlags().BoolVar(&hookMode, "hook", false, "Runs as an Atlantis pre workflow hook: --root and --output default to the repo in $DIR, and only a one line summary is printed")
+	generateCmd.PersistentFlags().BoolVar(&hookAffectedOnly, "hook-affected-only", false, "With --hook, only generates the projects affected by the files the pull request changes compared to $BASE_BRANCH_NAME")
+	generateCmd.PersistentFlags().StringVar(&sinceRef, "since", "", "Only regenerates the projects affected by the files changed since the git ref, including uncommitted changes, and keeps all other projects of the old output file as they are")
+}
+
+// Registers the flags of the generate command. Commands explaining what generate does take the same flags
+func addGenerateFlags(flags *pflag.FlagSet) {
 	pwd, err := os.Getwd()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	generateCmd.PersistentFlags().BoolVar(&autoPlan, "autoplan", false, "Enable auto plan. Default is disabled")
-	generateCmd.PersistentFlags().BoolVar(&autoMerge, "automerge", false, "Enable auto merge. Default is disabled")
-	generateCmd.PersistentFlags().BoolVar(&parallel, "parallel", true, "Enables plans and applys to happen in parallel. Default is enabled")
-	generateCmd.PersistentFlags().BoolVar(&ignoreLocalSubModules, "ignore-local-sub-modules", false, "When true, dependencies found in `dependency` blocks will be ignored")
-	generateCmd.PersistentFlags().StringSliceVar(&localSubModulesExclude, "local-sub-modules-exclude", []string{}, "Local sub modules that should be excluded from being added to 'when_modified' if --ignore-local-sub-modules is false (default)")
-	generateCmd.PersistentFlags().StringSliceVar(&autoPlanFileList, "autoplan-file-list", []string{"*.tf*"}, "Glob of module-local files that should be included in auto plan")
-	generateCmd.PersistentFlags().BoolVar(&createWorkspace, "create-workspace", false, "Use different workspace for each project. Default is use default workspace")
-	generateCmd.PersistentFlags().BoolVar(&preserveWorkflows, "preserve-workflows", true, "Preserves workflows from old output files. Default is true")
-	generateCmd.PersistentFlags().BoolVar(&preserveProjects, "preserve-projects", false, "Preserves projects from old output files to enable incremental builds. Default is false")
-	generateCmd.PersistentFlags().StringVar(&defaultWorkflow, "workflow", "", "Name of the workflow to be customized in the atlantis server. Default is to not set")
-	generateCmd.PersistentFlags().StringSliceVar(&defaultApplyRequirements, "apply-requirements", []string{}, "Requirements that must be satisfied before `atlantis apply` can be run. Currently the only supported requirements are `approved` and `mergeable`. Can be overridden by locals")
-	generateCmd.PersistentFlags().StringVar(&outputPath, "output", "", "Path of the file where configuration will be generated. Default is not to write to file")
-	generateCmd.PersistentFlags().StringVar(&filterPath, "filter", "", "Path or glob expression to the directory you want scope down the config for. Default is all files in root")
-	generateCmd.PersistentFlags().StringVar(&gitRoot, "root", pwd, "Path to the root directory of the git repo you want to build config for. Default is current dir")
-	generateCmd.PersistentFlags().StringVar(&defaultTerraformVersion, "terraform-version", "", "Default terraform version to specify for all modules. Can be overriden by locals")
-	generateCmd.PersistentFlags().Int64Var(&numExecutors, "num-executors", 15, "Number of executors used for parallel generation of projects. Default is 15")
-	generateCmd.PersistentFlags().BoolVar(&executionOrderGroups, "execution-order-groups", false, "Computes execution_order_groups for projects")
+	flags.BoolVar(&autoPlan, "autoplan", false, "Enable auto plan. Default is disabled")
+	flags.BoolVar(&autoMerge, "automerge", false, "Enable auto merge. Default is disabled")
+	flags.BoolVar(&parallel, "parallel", true, "Enables plans and applys to happen in parallel. Default is enabled")
+	flags.BoolVar(&ignoreLocalSubModules, "ignore-local-sub-modules", false, "When true, dependencies found in `dependency` blocks will be ignored")
+	flags.BoolVar(&ignoreFileFunctions, "ignore-file-functions", false, "When true, files read with file(), filebase64(), templatefile() and fileset() will not be added to 'when_modified'")
+	flags.BoolVar(&ignorePathAttributes, "ignore-path-attributes", false, "When true, local paths in attributes like `archive_file.source_dir` or `helm_release.chart` will not be added to 'when_modified'")
+	flags.StringSliceVar(&extraPathAttributes, "path-attributes", []string{}, "Additional resource or data source attributes holding local paths, in the `type.attribute` format. Added to the built-in list")
+	flags.StringSliceVar(&localSubModulesExclude, "local-sub-modules-exclude", []string{}, "Local sub modules that should be excluded from being added to 'when_modified' if --ignore-local-sub-modules is false (default)")
+	flags.StringSliceVar(&repoURLs, "repo-url", []string{}, "Remote URLs of this repo, like 'github.com/org/infra'. Git and GitHub module sources pointing at them are treated as local modules. Supports '*' wildcards")
+	flags.StringVar(&defaultProjectType, "project-type", terraformProjectType, "Project type deciding which module-local files trigger auto plan, either built-in or from the --config file. Can be overridden by locals and rules")
+	flags.StringSliceVar(&autoPlanFileList, "autoplan-file-list", []string{}, "Glob of module-local files that should be included in auto plan. Overrides the files of the --project-type flag. Can be overridden by locals")
+	flags.StringSliceVar(&whenModifiedExclude, "when-modified-exclude", []string{}, "Glob of module-local files that should never trigger auto plan, like '*.md'. Also applied to local sub modules. Can be overridden by locals")
+	flags.IntVar(&collapseWhenModifiedThreshold, "collapse-when-modified-threshold", 0, "Collapses 'when_modified' globs of more than this many sibling modules, like '../modules/a/*.tf', into one glob of their parent, like '../modules/*/*.tf'. Default is to never collapse")
+	flags.BoolVar(&createWorkspace, "create-workspace", false, "Use different workspace for each project. Default is use default workspace")
+	flags.BoolVar(&preserveWorkflows, "preserve-workflows", true, "Preserves workflows from old output files. Default is true")
+	flags.BoolVar(&preserveProjects, "preserve-projects", false, "Preserves projects from old output files to enable incremental builds. Default is false")
+	flags.BoolVar(&mergeProjects, "merge-projects", false, "When preserving projects, merges regenerated projects field by field into the old ones, keeping hand-written fields. Projects commented with '# managed: false' are left untouched. Default is false")
+	flags.BoolVar(&pruneProjects, "prune-projects", false, "When preserving projects, removes old projects whose directory was deleted, is excluded by --exclude or an .atlantisignore file, is no longer a root module or was skipped. Default is false")
+	flags.BoolVar(&dryRun, "dry-run", false, "Logs what would change, like pruned projects, without writing the output file")
+	flags.StringVar(&defaultWorkflow, "workflow", "", "Name of the workflow to be customized in the atlantis server. Default is to not set")
+	flags.StringSliceVar(&defaultApplyRequirements, "apply-requirements", []string{}, "Requirements that must be satisfied before `atlantis apply` can be run. Currently the only supported requirements are `approved` and `mergeable`. Can be overridden by locals")
+	flags.StringVar(&outputPath, "output", "", "Path of the file where configuration will be generated. Default is not to write to file")
+	flags.StringVar(&configPath, "config", "", "Path of a YAML file with rules applying settings to all projects whose directory matches a regular expression. Locals take precedence over rules")
+	flags.StringVar(&filterPath, "filter", "", "Path or glob expression to the directory you want scope down the config for. Default is all files in root")
+	flags.StringSliceVar(&includePatterns, "include", []string{}, "Glob of directories, relative to the root, that should become projects. Supports '**'. Can be repeated. Default is all directories")
+	flags.StringSliceVar(&excludePatterns, "exclude", []string{}, "Glob of directories, relative to the root, that should be skipped together with everything below them. Supports '**'. Can be repeated")
+	flags.StringVar(&gitRoot, "root", pwd, "Path to the root directory of the git repo you want to build config for. Default is current dir")
+	flags.StringVar(&defaultTerraformVersion, "terraform-version", "", "Default terraform version to specify for all modules. Can be overriden by locals")
+	flags.StringVar(&defaultTofuVersion, "tofu-version", "", "Default OpenTofu version to specify for all modules, emitted with 'terraform_distribution: opentofu'. Can be overriden by locals")
+	flags.Int64Var(&numExecutors, "num-executors", 15, "Number of executors used for parallel generation of projects. Default is 15")
+	flags.BoolVar(&executionOrderGroups, "execution-order-groups", false, "Computes execution_order_groups for projects")
+	flags.StringVar(&executionOrderGroupPins, "execution-order-group-pins", lowerBoundPins, "How --execution-order-groups treats groups set in `atlantis.execution_order_group` locals: 'lower-bound' only moves projects to later groups, 'exact' keeps them and fails if a dependency contradicts them")
+	flags.BoolVar(&strict, "strict", false, "Fails when Terraform files have syntax errors or other diagnostics, printing all of them. Default is to only log how many were found")
+	flags.StringVar(&headerComment, "header", "", "Comment written at the top of the output file, followed by the command line used, like 'This file is generated, do not edit it by hand'. Default is no header")
+	flags.BoolVar(&keepComments, "keep-comments", false, "Keeps the comments of the old output file, writing keys in a fixed order with 'dir' first. Implied by --merge-projects. Default is to sort keys, dropping comments")
+	flags.BoolVar(&logDecisions, "log-decisions", false, "Logs why projects were skipped or inherited settings from ancestor directories")
 }
 
 // Runs a set of arguments, returning the output
@@ -1,15 +1,21 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
 	"golang.org/x/sync/singleflight"
 )
 
@@ -22,24 +28,78 @@ func resetForRun() error {
 
 	// reset caches
 	requestGroup = singleflight.Group{}
-	// reset flags
+	directoryLocalsCache = sync.Map{}
+	commentAnnotationsCache = sync.Map{}
+	collectedDiagnostics = newDiagnosticsCollector()
+	// reset flags, including which of them were passed, as that is recorded in the generated header
+	generateCmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		flag.Changed = false
+	})
 	gitRoot = pwd
 	autoPlan = false
 	autoMerge = false
+	logDecisions = false
+	strict = false
+	ignoreFileFunctions = false
+	ignorePathAttributes = false
+	extraPathAttributes = []string{}
+	autoPlanFileList = []string{}
+	defaultProjectType = terraformProjectType
+	whenModifiedExclude = []string{}
+	collapseWhenModifiedThreshold = 0
+	executionOrderGroups = false
+	configPath = ""
+	failOnWarnings = false
+	dependentsFormat = textFormat
+	inventoryFormat = jsonFormat
+	blastRadiusFormat = textFormat
+	maxAffected = 0
+	hookMode = false
+	hookAffectedOnly = false
+	sinceRef = ""
+	executionOrderGroupPins = lowerBoundPins
+	repoURLs = []string{}
 	parallel = true
 	createWorkspace = false
 	createProjectName = false
 	preserveWorkflows = true
 	preserveProjects = true
+	mergeProjects = false
+	pruneProjects = false
+	dryRun = false
+	headerComment = ""
+	keepComments = false
 	defaultWorkflow = ""
 	filterPath = ""
+	includePatterns = []string{}
+	excludePatterns = []string{}
 	outputPath = ""
 	defaultTerraformVersion = ""
+	defaultTofuVersion = ""
 	defaultApplyRequirements = []string{}
 
 	return nil
 }
 
+// Runs a command, returning what it printed to its output instead of the generated config
+func runCommand(args []string) (string, error) {
+	if err := resetForRun(); err != nil {
+		return "", err
+	}
+
+	// Errors are returned instead, so they do not end up in the output
+	output := bytes.Buffer{}
+	rootCmd.SetOut(&output)
+	rootCmd.SilenceErrors = true
+	defer rootCmd.SetOut(nil)
+	defer func() { rootCmd.SilenceErrors = false }()
+
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+
+	return output.String(), err
+}
+
 // Runs a test, asserting the output produced matches a golden file
 func runTest(t *testing.T, goldenFile string, args []string) {
 	err := resetForRun()
@@ -302,6 +362,107 @@ func TestTerraformVersionConfig(t *testing.T) {
 	})
 }
 
+func TestOpenTofuProjects(t *testing.T) {
+	runTest(t, filepath.Join("golden", "opentofu.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "opentofu"),
+		"--terraform-version", "1.5.7",
+	})
+}
+
+func TestFailingOnConflictingVersionPins(t *testing.T) {
+	_, err := runCommand([]string{
+		"generate",
+		"--root",
+		filepath.Join("..", "test_examples", "opentofu_version_conflict"),
+	})
+	assert.EqualError(t, err, "app: atlantis.terraform_version and atlantis.tofu_version can not both be set")
+
+	_, err = runCommand([]string{
+		"generate",
+		"--root",
+		filepath.Join("..", "test_examples", "opentofu"),
+		"--terraform-version", "1.5.7",
+		"--tofu-version", "1.8.3",
+	})
+	assert.EqualError(t, err, "classic: --terraform-version and --tofu-version can not both be set")
+}
+
+func TestCommentAnnotations(t *testing.T) {
+	runTest(t, filepath.Join("golden", "comment_annotations.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "comment_annotations"),
+		"--autoplan",
+		"--execution-order-groups",
+	})
+}
+
+func TestWarningAboutUnknownAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("# atlantis: workfow=prod autoplan=false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := bytes.Buffer{}
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	annotations := readCommentAnnotations(dir)
+	if assert.Len(t, annotations, 1) {
+		assert.Equal(t, map[string]cty.Value{"autoplan": cty.False}, annotations[0].values)
+	}
+	assert.Contains(t, logs.String(), `Ignoring unknown setting workfow annotated at `)
+}
+
+func TestReportingInvalidAnnotationValues(t *testing.T) {
+	dir := t.TempDir()
+	module := "# atlantis: apply_requirements=[1]\nterraform {\n  backend \"s3\" {}\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stderr := bytes.Buffer{}
+	rootCmd.SetErr(&stderr)
+	defer rootCmd.SetErr(nil)
+
+	_, err := runCommand([]string{"generate", "--root", dir, "--output", filepath.Join(dir, "atlantis.yaml"), "--strict"})
+	if assert.Error(t, err) {
+		assert.Equal(t, "found 0 errors and 1 warnings in Terraform files", err.Error())
+	}
+	assert.Contains(t, stderr.String(), "Warning: Invalid atlantis setting")
+	assert.Contains(t, stderr.String(), "main.tf line 1")
+	assert.Contains(t, stderr.String(), "Element 0 of atlantis.apply_requirements is not a string")
+}
+
+func TestParsingAnnotations(t *testing.T) {
+	settings, err := parseAnnotation(` workflow=prod autoplan=false execution_order_group=3 terraform_version=1.10 apply_requirements=["approved", "mergeable"] name="with spaces"`)
+	assert.Nil(t, err)
+
+	values := map[string]cty.Value{}
+	for _, setting := range settings {
+		values[setting.name] = setting.value
+	}
+	assert.Equal(t, cty.StringVal("prod"), values["workflow"])
+	assert.Equal(t, cty.False, values["autoplan"])
+	assert.Equal(t, cty.StringVal("1.10"), values["terraform_version"])
+	assert.Equal(t, cty.StringVal("with spaces"), values["name"])
+
+	locals := resolveAtlantisValues(values, nil)
+	assert.Equal(t, []string{"approved", "mergeable"}, locals.ApplyRequirements)
+	assert.Equal(t, "1.10", locals.TerraformVersion)
+	assert.Equal(t, 3, *locals.ExecutionOrderGroup)
+
+	for text, message := range map[string]string{
+		" workflow":                      `"workflow" is not a name=value pair`,
+		" apply_requirements=[approved":  "unterminated quote or bracket",
+		" ":                              "no settings, expected name=value pairs",
+		" apply_requirements=[approved]": "invalid value of apply_requirements: Variables not allowed",
+	} {
+		_, err := parseAnnotation(text)
+		assert.EqualError(t, err, message)
+	}
+}
+
 func TestPreservingOldWorkflows(t *testing.T) {
 	err := resetForRun()
 	if err != nil {
@@ -616,3 +777,996 @@ func TestWithExecutionOrderGroups(t *testing.T) {
 		"--execution-order-groups",
 	})
 }
+
+func TestExecutionOrderGroupsWithPinnedLowerBounds(t *testing.T) {
+	runTest(t, filepath.Join("golden", "execution_order_pins.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "execution_order_pins"),
+		"--execution-order-groups",
+	})
+}
+
+func TestExecutionOrderGroupsFailOnContradictingExactPins(t *testing.T) {
+	filename := filepath.Join("test_artifacts", fmt.Sprintf("%d.yaml", rand.Int()))
+	defer os.Remove(filename)
+
+	_, err := runCommand([]string{
+		"generate",
+		"--output",
+		filename,
+		"--root",
+		filepath.Join("..", "test_examples", "execution_order_pins"),
+		"--execution-order-groups",
+		"--execution-order-group-pins",
+		"exact",
+	})
+	if assert.Error(t, err) {
+		assert.Equal(t, "pinned execution_order_group of app (0) contradicts its dependency on network (0), which must run in an earlier group", err.Error())
+	}
+
+	_, err = os.Stat(filename)
+	assert.True(t, os.IsNotExist(err), "Expected no output to be written when a pin contradicts a dependency")
+}
+
+func TestLayeringRulesFromConfigFile(t *testing.T) {
+	runTest(t, filepath.Join("golden", "layering_rules.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "layering_rules"),
+		"--config",
+		filepath.Join("..", "test_examples", "layering_rules", "rules.yaml"),
+	})
+}
+
+func TestFileFunctionDependencies(t *testing.T) {
+	runTest(t, filepath.Join("golden", "file_functions.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "file_functions"),
+	})
+}
+
+func TestPathAttributeDependencies(t *testing.T) {
+	runTest(t, filepath.Join("golden", "path_attributes.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "path_attributes"),
+	})
+}
+
+func TestExtraPathAttributeDependencies(t *testing.T) {
+	runTest(t, filepath.Join("golden", "path_attributes_extra.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "path_attributes"),
+		"--path-attributes",
+		"custom_uploader.directory",
+	})
+}
+
+func TestSameRepoGitModuleSource(t *testing.T) {
+	runTest(t, filepath.Join("golden", "same_repo_git_source.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "same_repo_git_source"),
+		"--repo-url",
+		"git@github.com:our-org/infra.git",
+	})
+}
+
+func TestSameRepoGitModuleSourceWithoutRepoURL(t *testing.T) {
+	runTest(t, filepath.Join("golden", "same_repo_git_source_no_flag.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "same_repo_git_source"),
+	})
+}
+
+func TestNormalizingRepoURLs(t *testing.T) {
+	for url, expected := range map[string]string{
+		"git@github.com:our-org/infra.git":            "github.com/our-org/infra",
+		"https://github.com/our-org/infra":            "github.com/our-org/infra",
+		"github.com/Our-Org/infra/":                   "github.com/our-org/infra",
+		"ssh://git@github.com/our-org/infra.git":      "github.com/our-org/infra",
+		"ssh://git@github.com:22/our-org/infra":       "github.com/our-org/infra",
+		"git::https://github.com:443/our-org/infra":   "github.com/our-org/infra",
+		"git::git@gitlab.example.com:group/sub/infra": "gitlab.example.com/group/sub/infra",
+	} {
+		assert.Equal(t, expected, normalizeRepoURL(url), url)
+	}
+}
+
+func TestResolvingSameRepoModuleSubDirs(t *testing.T) {
+	err := resetForRun()
+	if err != nil {
+		t.Error("Failed to reset default flags")
+		return
+	}
+	repoURLs = []string{"git@github.com:our-org/infra.git"}
+
+	for _, test := range []struct {
+		source string
+		subDir string
+		ok     bool
+	}{
+		{"git::ssh://git@github.com/our-org/infra.git//modules/vpc?ref=main", "modules/vpc", true},
+		{"git::ssh://git@github.com:22/our-org/infra.git//modules/vpc", "modules/vpc", true},
+		{"github.com/our-org/infra//modules/a/../vpc", "modules/a/../vpc", true},
+		{"git::ssh://git@github.com/our-org/infra.git//../secrets", "", false},
+		{"github.com/our-org/infra//modules/../../secrets", "", false},
+		{"git::ssh://git@github.com/our-org/other.git//modules/vpc", "", false},
+	} {
+		subDir, ok := sameRepoModuleSubDir(test.source)
+		assert.Equal(t, test.ok, ok, test.source)
+		assert.Equal(t, test.subDir, subDir, test.source)
+	}
+}
+
+func TestRepoRootRelativeExtraDependencies(t *testing.T) {
+	runTest(t, filepath.Join("golden", "repo_root_extra_dependencies.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "repo_root_extra_dependencies"),
+	})
+}
+
+func TestWarningAboutMissingExtraDependencies(t *testing.T) {
+	logs := bytes.Buffer{}
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := runCommand([]string{
+		"generate",
+		"--root",
+		filepath.Join("..", "test_examples", "repo_root_extra_dependencies"),
+		"--output",
+		filepath.Join("test_artifacts", fmt.Sprintf("%d.yaml", rand.Int())),
+		"--dry-run",
+	})
+	if err != nil {
+		t.Errorf("Failed to generate: %s", err)
+		return
+	}
+
+	assert.Contains(t, logs.String(), `level=warning msg="Extra dependency \"../common.tfvars\" of `)
+	assert.Contains(t, logs.String(), `envs/prod/app does not match any file"`)
+}
+
+func TestStrictModeFailsOnMissingAnnotatedExtraDependencies(t *testing.T) {
+	dir := t.TempDir()
+	module := "# atlantis: extra_dependencies=[\"missing.tfvars\"]\nterraform {\n  backend \"s3\" {}\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics := bytes.Buffer{}
+	rootCmd.SetErr(&diagnostics)
+	defer rootCmd.SetErr(nil)
+
+	_, err := runCommand([]string{"generate", "--root", dir, "--output", filepath.Join(dir, "atlantis.yaml"), "--strict"})
+	assert.EqualError(t, err, "found 0 errors and 1 warnings in Terraform files")
+	assert.Contains(t, diagnostics.String(), "Warning: Invalid extra dependency")
+	assert.Contains(t, diagnostics.String(), "main.tf line 1")
+	assert.Contains(t, diagnostics.String(), `Extra dependency "missing.tfvars" of`)
+	assert.Contains(t, diagnostics.String(), "does not match any file")
+}
+
+func TestAtlantisIgnoreFiles(t *testing.T) {
+	runTest(t, filepath.Join("golden", "atlantisignore.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "atlantisignore"),
+	})
+}
+
+func TestIncludeAndExcludePatterns(t *testing.T) {
+	runTest(t, filepath.Join("golden", "include_exclude.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "atlantisignore"),
+		"--include",
+		"envs/**",
+		"--exclude",
+		"envs/dev",
+	})
+}
+
+func TestInheritingLocalsFromAncestors(t *testing.T) {
+	runTest(t, filepath.Join("golden", "ancestor_locals.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "ancestor_locals"),
+		"--autoplan",
+	})
+}
+
+func TestWhenModifiedExcludePatterns(t *testing.T) {
+	runTest(t, filepath.Join("golden", "when_modified_exclude.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "when_modified_exclude"),
+		"--when-modified-exclude",
+		"*.md",
+	})
+}
+
+func TestNormalizingWhenModified(t *testing.T) {
+	runTest(t, filepath.Join("golden", "when_modified_normalize.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "when_modified_normalize"),
+		"--collapse-when-modified-threshold",
+		"2",
+	})
+}
+
+func TestNormalizingWhenModifiedKeepsEntriesOutsideOfTheProject(t *testing.T) {
+	assert.Equal(t, []string{"**", "../shared/versions.tf"}, normalizeWhenModified([]string{"**", "../shared/versions.tf"}))
+
+	normalized := normalizeWhenModified([]string{
+		"**",
+		"**/*.tf",
+		"../shared/versions.tf",
+		"../../common/*.tf",
+		"../**",
+		"../modules/main.tf",
+		"main.tf",
+	})
+
+	assert.Equal(t, []string{
+		"**",
+		"../**",
+		"../../common/*.tf",
+	}, normalized)
+}
+
+func TestNormalizingWhenModifiedKeepsTheOrderOfExclusions(t *testing.T) {
+	normalized := normalizeWhenModified([]string{
+		"values/*.yaml",
+		"*.tf*",
+		"main.tf",
+		"!values/secret.yaml",
+		"!*.md",
+		"values/secret.yaml",
+		"./values/secret.yaml",
+	})
+
+	assert.Equal(t, []string{
+		"*.tf*",
+		"values/*.yaml",
+		"!*.md",
+		"!values/secret.yaml",
+		"values/secret.yaml",
+	}, normalized)
+}
+
+func TestDiagnosticsWithoutStrictMode(t *testing.T) {
+	runTest(t, filepath.Join("golden", "strict_non_strict.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "strict"),
+	})
+}
+
+func TestIgnoringListElementsThatAreNotStrings(t *testing.T) {
+	dir := t.TempDir()
+	module := "terraform {\n  backend \"s3\" {}\n}\n\nlocals {\n  atlantis = {\n    autoplan_file_list    = [\"*.tf\", 1]\n    when_modified_exclude = [true]\n  }\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := bytes.Buffer{}
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	outputPath := filepath.Join(dir, "atlantis.yaml")
+	if _, err := runCommand([]string{"generate", "--root", dir, "--output", outputPath}); err != nil {
+		t.Fatalf("Failed to generate: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := AtlantisConfig{}
+	if err := yaml.Unmarshal(contents, &generated); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, generated.Projects, 1) {
+		assert.Equal(t, []string{"*.tf"}, generated.Projects[0].Autoplan.WhenModified)
+	}
+	assert.Contains(t, logs.String(), "Element 1 of atlantis.autoplan_file_list is not a string at main.tf:6, ignoring it")
+	assert.Contains(t, logs.String(), "Element 0 of atlantis.when_modified_exclude is not a string at main.tf:6, ignoring it")
+}
+
+func TestDiagnosticsFailStrictMode(t *testing.T) {
+	filename := filepath.Join("test_artifacts", fmt.Sprintf("%d.yaml", rand.Int()))
+	defer os.Remove(filename)
+
+	diagnostics := bytes.Buffer{}
+	rootCmd.SetErr(&diagnostics)
+	defer rootCmd.SetErr(nil)
+
+	_, err := runCommand([]string{
+		"generate",
+		"--output",
+		filename,
+		"--root",
+		filepath.Join("..", "test_examples", "strict"),
+		"--strict",
+	})
+	assert.EqualError(t, err, "found 1 errors and 0 warnings in Terraform files")
+	assert.Contains(t, diagnostics.String(), "Error: Unclosed configuration block")
+	assert.Contains(t, diagnostics.String(), filepath.Join("strict", "modules", "broken", "main.tf")+" line 1:")
+
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("Expected no output to be written in strict mode, got: %v", err)
+	}
+}
+
+func TestStrictModeAcceptsNewerTerraformFeatures(t *testing.T) {
+	filename := filepath.Join("test_artifacts", fmt.Sprintf("%d.yaml", rand.Int()))
+	defer os.Remove(filename)
+
+	diagnostics := bytes.Buffer{}
+	rootCmd.SetErr(&diagnostics)
+	defer rootCmd.SetErr(nil)
+
+	_, err := runCommand([]string{
+		"generate",
+		"--output",
+		filename,
+		"--root",
+		filepath.Join("..", "test_examples", "newer_terraform_features"),
+		"--strict",
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, diagnostics.String())
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(contents), "dir: app")
+}
+
+func TestMergingDropsSettingsRemovedFromLocals(t *testing.T) {
+	filename := filepath.Join("test_artifacts", fmt.Sprintf("%d.yaml", rand.Int()))
+	defer os.Remove(filename)
+
+	// The workflow and version were generated last run, the name was added by hand
+	contents := []byte(`projects:
+  # generated: dir, autoplan, workflow, terraform_version
+  - dir: app
+    name: custom-app-name
+    workflow: removed-from-locals
+    terraform_version: 1.0.0
+    autoplan:
+      enabled: false
+      when_modified:
+        - '*.tf'
+        - ../stale/*.tf*
+`)
+	ioutil.WriteFile(filename, contents, 0644)
+
+	logs := bytes.Buffer{}
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := runCommand([]string{
+		"generate",
+		"--preserve-projects",
+		"--merge-projects",
+		"--output",
+		filename,
+		"--root",
+		filepath.Join("..", "test_examples", "merge_projects"),
+	})
+	if err != nil {
+		t.Errorf("Failed to generate: %s", err)
+		return
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Error("Failed to read file")
+		return
+	}
+	config := AtlantisConfig{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		t.Errorf("Failed to parse output: %s", err)
+		return
+	}
+
+	app := config.Projects[0]
+	assert.Equal(t, "app", app.Dir)
+	assert.Equal(t, "custom-app-name", app.Name)
+	assert.Equal(t, "", app.Workflow)
+	assert.Equal(t, "", app.TerraformVersion)
+	assert.NotContains(t, app.Autoplan.WhenModified, "../stale/*.tf*")
+	assert.Contains(t, logs.String(), `Dropping when_modified entry \"../stale/*.tf*\" of project app`)
+}
+
+func TestMergingOldProjects(t *testing.T) {
+	err := resetForRun()
+	if err != nil {
+		t.Error("Failed to reset default flags")
+		return
+	}
+
+	randomInt := rand.Int()
+	filename := filepath.Join("test_artifacts", fmt.Sprintf("%d.yaml", randomInt))
+	defer os.Remove(filename)
+
+	// Create an existing file with hand-written fields, a hand-added dependency and an unmanaged project
+	contents := []byte(`projects:
+- autoplan:
+    enabled: true
+    when_modified:
+    - '*.tf*'
+    - ../stale/*.tf*
+    - ../docs/runbook.md # plans on runbook changes
+  dir: app
+  name: custom-app-name
+  workflow: custom
+# managed: false
+- autoplan:
+    enabled: false
+    when_modified:
+    - '*.tf*'
+    - ../vendor/**
+  dir: legacy
+  workflow: hand-written
+- autoplan:
+    enabled: false
+    when_modified:
+    - '*.tf*'
+  dir: removed # still listed, as it is outside of this run
+`)
+	ioutil.WriteFile(filename, contents, 0644)
+
+	content, err := RunWithFlags(filename, []string{
+		"generate",
+		"--preserve-projects",
+		"--merge-projects",
+		"--output",
+		filename,
+		"--root",
+		filepath.Join("..", "test_examples", "merge_projects"),
+	})
+	if err != nil {
+		t.Error("Failed to read file")
+		return
+	}
+
+	goldenContents, err := ioutil.ReadFile(filepath.Join("golden", "mergedProjects.yaml"))
+	if err != nil {
+		t.Error("Failed to read golden file")
+		return
+	}
+
+	if string(content) != string(goldenContents) {
+		t.Errorf("Content did not match golden file.\n\nExpected Content: %s\n\nContent: %s", string(goldenContents), string(content))
+	}
+}
+
+func TestPruningStaleProjects(t *testing.T) {
+	err := resetForRun()
+	if err != nil {
+		t.Error("Failed to reset default flags")
+		return
+	}
+
+	randomInt := rand.Int()
+	filename := filepath.Join("test_artifacts", fmt.Sprintf("%d.yaml", randomInt))
+	defer os.Remove(filename)
+
+	// Create an existing file with projects that were deleted, are excluded, are no longer root modules or are skipped
+	contents := []byte(`projects:
+- autoplan:
+    enabled: false
+    when_modified:
+    - '*.tf*'
+  dir: deleted
+- autoplan:
+    enabled: false
+    when_modified:
+    - '*.tf*'
+  dir: not_root
+- autoplan:
+    enabled: false
+    when_modified:
+    - '*.tf*'
+  dir: skipped
+- autoplan:
+    enabled: false
+    when_modified:
+    - '*.tf*'
+  dir: ignored
+- autoplan:
+    enabled: false
+    when_modified:
+    - '*.tf*'
+  dir: excluded/app
+`)
+	ioutil.WriteFile(filename, contents, 0644)
+
+	content, err := RunWithFlags(filename, []string{
+		"generate",
+		"--preserve-projects",
+		"--prune-projects",
+		"--exclude",
+		"excluded",
+		"--output",
+		filename,
+		"--root",
+		filepath.Join("..", "test_examples", "prune_projects"),
+	})
+	if err != nil {
+		t.Error("Failed to read file")
+		return
+	}
+
+	goldenContents, err := ioutil.ReadFile(filepath.Join("golden", "prunedProjects.yaml"))
+	if err != nil {
+		t.Error("Failed to read golden file")
+		return
+	}
+
+	if string(content) != string(goldenContents) {
+		t.Errorf("Content did not match golden file.\n\nExpected Content: %s\n\nContent: %s", string(goldenContents), string(content))
+	}
+}
+
+func TestPreservingCommentsWithGeneratedHeader(t *testing.T) {
+	err := resetForRun()
+	if err != nil {
+		t.Error("Failed to reset default flags")
+		return
+	}
+	headerComment = "Generated file, do not edit"
+
+	randomInt := rand.Int()
+	filename := filepath.Join("test_artifacts", fmt.Sprintf("%d.yaml", randomInt))
+	defer os.Remove(filename)
+
+	// Create an existing file with the header of a previous run and comments in every section
+	contents := []byte(`# Generated file, do not edit
+# Command: terraform-atlantis-config generate --parallel=false
+version: 3 # the only supported version
+projects:
+# owned by the platform team
+- dir: app
+  autoplan:
+    enabled: false
+    when_modified:
+    - '*.tf' # terraform files
+workflows:
+  # applies with a custom plan file
+  custom:
+    plan:
+      steps:
+      - init
+      - plan # plans with the default flags
+    apply:
+      steps:
+      - apply
+`)
+	ioutil.WriteFile(filename, contents, 0644)
+
+	content, err := RunWithFlags(filename, []string{
+		"generate",
+		"--autoplan",
+		"--keep-comments",
+		"--output",
+		filename,
+		"--root",
+		filepath.Join("..", "test_examples", "generated_header"),
+	})
+	if err != nil {
+		t.Error("Failed to read file")
+		return
+	}
+
+	goldenContents, err := ioutil.ReadFile(filepath.Join("golden", "generatedHeader.yaml"))
+	if err != nil {
+		t.Error("Failed to read golden file")
+		return
+	}
+
+	if string(content) != string(goldenContents) {
+		t.Errorf("Content did not match golden file.\n\nExpected Content: %s\n\nContent: %s", string(goldenContents), string(content))
+	}
+}
+
+func TestLintingBackends(t *testing.T) {
+	output, err := runCommand([]string{
+		"lint-backends",
+		"--root",
+		filepath.Join("..", "test_examples", "backend_lint"),
+	})
+	if err == nil {
+		t.Error("Expected shared states to fail the lint")
+	}
+
+	goldenContents, err := ioutil.ReadFile(filepath.Join("golden", "backend_lint.txt"))
+	if err != nil {
+		t.Error("Failed to read golden file")
+		return
+	}
+
+	assert.Equal(t, string(goldenContents), output)
+}
+
+func TestExplainingProject(t *testing.T) {
+	output, err := runCommand([]string{
+		"explain",
+		"app",
+		"--root",
+		filepath.Join("..", "test_examples", "explain"),
+		"--config",
+		filepath.Join("..", "test_examples", "explain", "rules.yaml"),
+		"--when-modified-exclude",
+		"*.md",
+	})
+	if err != nil {
+		t.Errorf("Failed to explain project: %s", err)
+		return
+	}
+
+	goldenContents, err := ioutil.ReadFile(filepath.Join("golden", "explain.txt"))
+	if err != nil {
+		t.Error("Failed to read golden file")
+		return
+	}
+
+	assert.Equal(t, string(goldenContents), output)
+}
+
+func TestListingDependents(t *testing.T) {
+	for _, format := range []string{"txt", "json"} {
+		args := []string{
+			"dependents",
+			filepath.Join("modules", "subnet"),
+			"--root",
+			filepath.Join("..", "test_examples", "dependents"),
+		}
+		if format == "json" {
+			args = append(args, "--format", "json")
+		}
+
+		output, err := runCommand(args)
+		if err != nil {
+			t.Errorf("Failed to list dependents: %s", err)
+			return
+		}
+
+		goldenContents, err := ioutil.ReadFile(filepath.Join("golden", "dependents."+format))
+		if err != nil {
+			t.Error("Failed to read golden file")
+			return
+		}
+
+		assert.Equal(t, string(goldenContents), output)
+	}
+}
+
+func TestWhenModifiedMatch(t *testing.T) {
+	entries := []string{"*.tf*", "../modules/**/*.tf", "!../modules/legacy/*.tf"}
+
+	entry, ok := whenModifiedMatch(entries, "../modules/network/main.tf")
+	assert.True(t, ok)
+	assert.Equal(t, "../modules/**/*.tf", entry)
+
+	_, ok = whenModifiedMatch(entries, "../modules/legacy/main.tf")
+	assert.False(t, ok)
+
+	_, ok = whenModifiedMatch(entries, "README.md")
+	assert.False(t, ok)
+}
+
+func TestListingUnusedModules(t *testing.T) {
+	output, err := runCommand([]string{
+		"unused-modules",
+		"--root",
+		filepath.Join("..", "test_examples", "unused_modules"),
+		"--exclude",
+		"vendor",
+	})
+	if err != nil {
+		t.Errorf("Failed to list unused modules: %s", err)
+		return
+	}
+
+	assert.Equal(t, "modules/legacy\nmodules/orphan\n", output)
+}
+
+func TestListingUnusedModulesLimitedByInclude(t *testing.T) {
+	output, err := runCommand([]string{
+		"unused-modules",
+		"--root",
+		filepath.Join("..", "test_examples", "unused_modules"),
+		"--exclude",
+		"vendor",
+		"--include",
+		"modules/legacy",
+	})
+	if err != nil {
+		t.Errorf("Failed to list unused modules: %s", err)
+		return
+	}
+
+	assert.Equal(t, "modules/legacy\n", output)
+}
+
+func TestExportingInventory(t *testing.T) {
+	for _, format := range []string{"json", "csv"} {
+		output, err := runCommand([]string{
+			"inventory",
+			"--root",
+			filepath.Join("..", "test_examples", "inventory"),
+			"--format",
+			format,
+		})
+		if err != nil {
+			t.Errorf("Failed to export the inventory: %s", err)
+			return
+		}
+
+		goldenContents, err := ioutil.ReadFile(filepath.Join("golden", "inventory."+format))
+		if err != nil {
+			t.Error("Failed to read golden file")
+			return
+		}
+
+		assert.Equal(t, string(goldenContents), output)
+	}
+}
+
+func TestBlastRadius(t *testing.T) {
+	args := []string{
+		"blast-radius",
+		"--root",
+		filepath.Join("..", "test_examples", "blast_radius"),
+		"--autoplan",
+		"modules/shared/main.tf",
+		"app3/main.tf",
+		"README.md",
+	}
+
+	output, err := runCommand(args)
+	if err != nil {
+		t.Errorf("Failed to report the blast radius: %s", err)
+		return
+	}
+
+	goldenContents, err := ioutil.ReadFile(filepath.Join("golden", "blast_radius.txt"))
+	if err != nil {
+		t.Error("Failed to read golden file")
+		return
+	}
+	assert.Equal(t, string(goldenContents), output)
+
+	_, err = runCommand(append(args, "--max-affected", "2"))
+	if err == nil {
+		t.Error("Expected the change to exceed --max-affected")
+		return
+	}
+	assert.Contains(t, err.Error(), "would autoplan 3 projects, more than the 2 allowed by --max-affected")
+	assert.Contains(t, err.Error(), "modules/shared (3 projects)")
+}
+
+// Runs git in `dir`, failing the test on errors
+func runGit(t *testing.T, dir string, args ...string) string {
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	output, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %s: %s", args, err, output)
+	}
+
+	return string(output)
+}
+
+func TestHookModeGeneratesAffectedProjects(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	for _, dir := range []string{"network", "app"} {
+		if err := os.MkdirAll(filepath.Join(repo, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(repo, dir, "main.tf"), []byte("terraform {\n  backend \"s3\" {}\n}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, repo, "init", "--quiet", "--initial-branch=main")
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "--quiet", "-m", "Initial commit")
+	runGit(t, repo, "checkout", "--quiet", "-b", "feature")
+	if err := ioutil.WriteFile(filepath.Join(repo, "app", "outputs.tf"), []byte("output \"name\" {\n  value = \"app\"\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "--quiet", "-m", "Change app")
+
+	t.Setenv("DIR", repo)
+	t.Setenv("BASE_BRANCH_NAME", "main")
+	t.Setenv("HEAD_COMMIT", "feature")
+	t.Setenv("PULL_NUM", "42")
+
+	output, err := runCommand([]string{"generate", "--hook", "--hook-affected-only"})
+	if err != nil {
+		t.Fatalf("Failed to run as a hook: %s", err)
+	}
+	assert.Equal(t, "terraform-atlantis-config: wrote 1 projects to atlantis.yaml for pull request #42, affected by 1 changed files\n", output)
+
+	contents, err := ioutil.ReadFile(filepath.Join(repo, "atlantis.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read the generated config: %s", err)
+	}
+	assert.Contains(t, string(contents), "dir: app")
+	assert.NotContains(t, string(contents), "dir: network")
+}
+
+func TestGeneratingSinceRefKeepsUnaffectedProjects(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	files := map[string]string{
+		"app/main.tf":            "terraform {\n  backend \"s3\" {}\n}\n\nmodule \"shared\" {\n  source = \"../modules/shared\"\n}\n",
+		"network/main.tf":        "terraform {\n  backend \"s3\" {}\n}\n",
+		"modules/shared/main.tf": "variable \"name\" {}\n",
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repo, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(repo, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Both projects of the old config have a workflow that generating them again would drop
+	oldConfig := `version: 3
+projects:
+- dir: app
+  workflow: stale
+  autoplan:
+    when_modified:
+    - '*.tf*'
+    - ../modules/shared/*.tf*
+    enabled: false
+- dir: network
+  workflow: kept # pinned by hand
+  autoplan:
+    when_modified:
+    - '*.tf*'
+    enabled: false
+`
+	outputPath := filepath.Join(repo, "atlantis.yaml")
+	if err := ioutil.WriteFile(outputPath, []byte(oldConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "init", "--quiet", "--initial-branch=main")
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "--quiet", "-m", "Initial commit")
+
+	if err := ioutil.WriteFile(filepath.Join(repo, "modules", "shared", "main.tf"), []byte("variable \"name\" {\n  default = \"changed\"\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runCommand([]string{"generate", "--root", repo, "--output", outputPath, "--keep-comments", "--preserve-projects=false", "--since", "HEAD"})
+	if err != nil {
+		t.Fatalf("Failed to generate since HEAD: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := AtlantisConfig{}
+	if err := yaml.Unmarshal(contents, &generated); err != nil {
+		t.Fatal(err)
+	}
+
+	workflows := map[string]string{}
+	for _, project := range generated.Projects {
+		workflows[project.Dir] = project.Workflow
+	}
+	assert.Equal(t, map[string]string{"app": "", "network": "kept"}, workflows)
+	assert.Contains(t, string(contents), "workflow: kept # pinned by hand")
+}
+
+func TestGeneratingSinceRefKeepsPinnedExecutionOrderGroups(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	files := map[string]string{
+		"app/main.tf":        "terraform {\n  backend \"s3\" {}\n}\n\nmodule \"network\" {\n  source = \"../network\"\n}\n",
+		"network/main.tf":    "terraform {\n  backend \"s3\" {}\n}\n",
+		"monitoring/main.tf": "terraform {\n  backend \"s3\" {}\n}\n\nlocals {\n  atlantis = {\n    execution_order_group = 3\n  }\n}\n",
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repo, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(repo, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outputPath := filepath.Join(repo, "atlantis.yaml")
+	if _, err := runCommand([]string{"generate", "--root", repo, "--output", outputPath, "--execution-order-groups"}); err != nil {
+		t.Fatalf("Failed to generate: %s", err)
+	}
+	runGit(t, repo, "init", "--quiet", "--initial-branch=main")
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "--quiet", "-m", "Initial commit")
+
+	// Only app and network are generated again, monitoring is kept from the old config
+	if err := ioutil.WriteFile(filepath.Join(repo, "network", "main.tf"), []byte("terraform {\n  backend \"s3\" {}\n}\n\nvariable \"name\" {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runCommand([]string{"generate", "--root", repo, "--output", outputPath, "--preserve-projects=false", "--execution-order-groups", "--since", "HEAD"})
+	if err != nil {
+		t.Fatalf("Failed to generate since HEAD: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := AtlantisConfig{}
+	if err := yaml.Unmarshal(contents, &generated); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := map[string]int{}
+	for _, project := range generated.Projects {
+		groups[project.Dir] = project.ExecutionOrderGroup
+	}
+	assert.Equal(t, map[string]int{"app": 1, "monitoring": 3, "network": 0}, groups)
+}
+
+func TestProjectTypes(t *testing.T) {
+	runTest(t, filepath.Join("golden", "project_types.yaml"), []string{
+		"--root",
+		filepath.Join("..", "test_examples", "project_types"),
+		"--config",
+		filepath.Join("..", "test_examples", "project_types", "types.yaml"),
+		"--autoplan-file-list",
+		"*.tf,*.tfvars",
+	})
+}
+
+func TestSubModuleFilesLeaveOutRootModuleOnlyFiles(t *testing.T) {
+	files := subModuleFiles([]string{"*.tf", ".terraform.lock.hcl", "src/**", "tests/**", "!*.md"})
+
+	assert.Equal(t, []string{"*.tf", "src/**", "!*.md"}, files)
+}
+
+func TestFailingOnUnknownProjectType(t *testing.T) {
+	_, err := runCommand([]string{
+		"generate",
+		"--root",
+		filepath.Join("..", "test_examples", "project_types"),
+		"--config",
+		filepath.Join("..", "test_examples", "project_types", "types.yaml"),
+		"--project-type",
+		"pulumi",
+	})
+	if err == nil {
+		t.Error("Expected an unknown project type to fail")
+		return
+	}
+	assert.EqualError(t, err, `app: unknown project type "pulumi", known types are lambda, policy, terraform`)
+}
+
+func TestResolvingProjectTypeFiles(t *testing.T) {
+	custom := map[string]ProjectType{
+		"policy":  {Extends: "terraform", AutoPlanFileList: []string{"policy/**"}},
+		"looping": {Extends: "cycle"},
+		"cycle":   {Extends: "looping"},
+	}
+
+	files, err := resolveProjectTypeFiles("policy", custom)
+	assert.Nil(t, err)
+	assert.Equal(t, append([]string{"policy/**"}, terraformProjectFiles...), files)
+
+	_, err = resolveProjectTypeFiles("looping", custom)
+	assert.EqualError(t, err, `project type "looping" extends itself through looping -> cycle`)
+}
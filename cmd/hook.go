@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dennislapchenko/terraform-atlantis-config/internal/git"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Environment variables Atlantis sets when running a pre workflow hook
+const (
+	hookDirEnv        = "DIR"
+	hookHeadCommitEnv = "HEAD_COMMIT"
+	hookBaseBranchEnv = "BASE_BRANCH_NAME"
+	hookPullNumEnv    = "PULL_NUM"
+)
+
+// What Atlantis tells a pre workflow hook about the pull request
+type hookEnvironment struct {
+	// Absolute path of the checked out repo
+	dir string
+
+	headCommit string
+	baseBranch string
+	pullNum    string
+}
+
+func readHookEnvironment() (hookEnvironment, error) {
+	env := hookEnvironment{
+		dir:        os.Getenv(hookDirEnv),
+		headCommit: os.Getenv(hookHeadCommitEnv),
+		baseBranch: os.Getenv(hookBaseBranchEnv),
+		pullNum:    os.Getenv(hookPullNumEnv),
+	}
+	if env.dir == "" {
+		return env, fmt.Errorf("--hook needs the %s environment variable, which Atlantis sets for pre workflow hooks", hookDirEnv)
+	}
+
+	return env, nil
+}
+
+// Defaults `--root` to the checked out repo and `--output` to its atlantis.yaml, unless they were passed,
+// and switches to short log lines without timestamps, as Atlantis shows the output of hooks as is.
+// Returns a function restoring the previous log settings
+func applyHookEnvironment(cmd *cobra.Command, env hookEnvironment) func() {
+	if !cmd.Flags().Changed("root") {
+		gitRoot = env.dir
+	}
+	if !cmd.Flags().Changed("output") {
+		outputPath = filepath.Join(env.dir, "atlantis.yaml")
+	}
+
+	level := log.GetLevel()
+	formatter := log.StandardLogger().Formatter
+	if level > log.WarnLevel && !logDecisions {
+		log.SetLevel(log.WarnLevel)
+	}
+	log.SetFormatter(&log.TextFormatter{DisableTimestamp: true, DisableColors: true})
+
+	return func() {
+		log.SetLevel(level)
+		log.SetFormatter(formatter)
+	}
+}
+
+// Lists the files changed by the pull request, relative to the repo root, by diffing the head commit against
+// the base branch in the local checkout. The remote tracking branch is preferred, as Atlantis may not create
+// a local one
+func (env hookEnvironment) changedFiles() ([]string, error) {
+	if env.baseBranch == "" {
+		return nil, fmt.Errorf("--hook-affected-only needs the %s environment variable", hookBaseBranchEnv)
+	}
+
+	repo, err := git.Open(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	base, ok := repo.ResolveRef("origin/"+env.baseBranch, env.baseBranch)
+	if !ok {
+		return nil, fmt.Errorf("base branch %s is not in the checkout at %s", env.baseBranch, gitRoot)
+	}
+
+	head := env.headCommit
+	if head == "" {
+		head = "HEAD"
+	}
+
+	return changedFilesBetween(base, head)
+}
+
+// Prints a single line summing up the run, which is what shows up in the Atlantis UI
+func printHookSummary(cmd *cobra.Command, env hookEnvironment, projects int, changedFiles []string) {
+	summary := fmt.Sprintf("terraform-atlantis-config: wrote %d projects to %s", projects, relativeFile(outputPath))
+	if env.pullNum != "" {
+		summary += " for pull request #" + env.pullNum
+	}
+	if changedFiles != nil {
+		summary += fmt.Sprintf(", affected by %d changed files", len(changedFiles))
+	}
+	if dryRun {
+		summary += " (dry run)"
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), summary)
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	log "github.com/sirupsen/logrus"
+)
+
+// Name of the gitignore-style files listing directories that should never become projects
+const atlantisIgnoreFileName = ".atlantisignore"
+
+// A single line of an `.atlantisignore` file
+type ignoreRule struct {
+	// Pattern relative to the directory of the ignore file
+	pattern string
+
+	// If the line started with `!`, re-including previously ignored directories
+	negate bool
+}
+
+// Decides which directories are walked and which root modules become projects, based on
+// the `--include` and `--exclude` flags and `.atlantisignore` files
+type directoryFilter struct {
+	// Parsed `.atlantisignore` files by directory, loaded lazily
+	ignoreFiles map[string][]ignoreRule
+}
+
+func newDirectoryFilter() *directoryFilter {
+	return &directoryFilter{ignoreFiles: map[string][]ignoreRule{}}
+}
+
+// Checks if a directory, and everything below it, should be skipped
+func (f *directoryFilter) isExcluded(dir string) bool {
+	relativeDir, ok := relativeToGitRoot(dir)
+	if !ok {
+		return false
+	}
+
+	for _, pattern := range excludePatterns {
+		if matchPattern(pattern, relativeDir) {
+			log.Debugf("Skipping %s, as it matches --exclude %s", dir, pattern)
+			return true
+		}
+	}
+
+	if relativeDir == "." {
+		return false
+	}
+
+	// Ignore files apply to everything below the directory they are in, deeper files take precedence
+	ignored := false
+	ancestor := filepath.Clean(gitRoot)
+	for _, segment := range strings.Split(relativeDir, "/") {
+		relativeToAncestor, _ := filepath.Rel(ancestor, filepath.Join(gitRoot, relativeDir))
+		for _, rule := range f.rules(ancestor) {
+			if matchPattern(rule.pattern, filepath.ToSlash(relativeToAncestor)) {
+				ignored = !rule.negate
+			}
+		}
+		ancestor = filepath.Join(ancestor, segment)
+	}
+	if ignored {
+		log.Debugf("Skipping %s, as it is listed in an %s file", dir, atlantisIgnoreFileName)
+	}
+
+	return ignored
+}
+
+// Checks if a root module in a directory that was not excluded should become a project
+func (f *directoryFilter) isIncluded(dir string) bool {
+	if len(includePatterns) == 0 {
+		return true
+	}
+
+	relativeDir, ok := relativeToGitRoot(dir)
+	if !ok {
+		return false
+	}
+
+	for _, pattern := range includePatterns {
+		if matchPattern(pattern, relativeDir) {
+			return true
+		}
+	}
+
+	log.Debugf("Skipping %s, as it does not match any --include pattern", dir)
+	return false
+}
+
+func (f *directoryFilter) rules(dir string) []ignoreRule {
+	if rules, ok := f.ignoreFiles[dir]; ok {
+		return rules
+	}
+
+	rules, err := readIgnoreFile(filepath.Join(dir, atlantisIgnoreFileName))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Failed to read %s: %s", filepath.Join(dir, atlantisIgnoreFileName), err)
+	}
+	f.ignoreFiles[dir] = rules
+
+	return rules
+}
+
+// Parses an ignore file following the gitignore syntax. Patterns without a slash match at any depth,
+// other patterns are relative to the directory of the file
+func readIgnoreFile(path string) ([]ignoreRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := []ignoreRule{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+
+		// Only directories are ever matched, so a trailing slash makes no difference
+		line = strings.TrimSuffix(line, "/")
+		if strings.Contains(line, "/") {
+			rule.pattern = strings.TrimPrefix(line, "/")
+		} else {
+			rule.pattern = "**/" + line
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+func matchPattern(pattern string, path string) bool {
+	matched, err := doublestar.Match(pattern, path)
+	if err != nil {
+		log.Warnf("Ignoring malformed pattern %q: %s", pattern, err)
+		return false
+	}
+
+	return matched
+}
+
+// Returns the slash separated path of `dir` relative to the repo root
+func relativeToGitRoot(dir string) (string, bool) {
+	absoluteDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	relativeDir, err := filepath.Rel(gitRoot, absoluteDir)
+	if err != nil || relativeDir == ".." || strings.HasPrefix(filepath.ToSlash(relativeDir), "../") {
+		return "", false
+	}
+
+	return filepath.ToSlash(relativeDir), true
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/configs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Versions and sources used by a root module, together with the local modules it calls
+type inventoryProject struct {
+	Dir string `json:"dir"`
+
+	// Type of the backend, like `s3`
+	Backend string `json:"backend"`
+
+	// The `required_version` constraints of the root module, joined by `, `
+	RequiredVersion string `json:"required_version,omitempty"`
+
+	Modules   []inventoryModule   `json:"modules"`
+	Providers []inventoryProvider `json:"providers"`
+}
+
+type inventoryModule struct {
+	Name    string `json:"name"`
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+
+	// Dir of the module declaring the call, relative to the repo root
+	DeclaredIn string `json:"declared_in"`
+}
+
+type inventoryProvider struct {
+	Name string `json:"name"`
+
+	// Fully qualified provider address, like `registry.terraform.io/hashicorp/aws`
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+
+	// Dir of the module declaring the requirement, relative to the repo root
+	DeclaredIn string `json:"declared_in"`
+}
+
+type inventoryReport struct {
+	Projects []inventoryProject `json:"projects"`
+}
+
+// Collects the inventory of a root module. Module calls and provider requirements of the local modules it
+// calls are included, as their versions apply to the project as much as the ones of the root module
+func buildInventory(rootModule *configs.Module) inventoryProject {
+	project := inventoryProject{
+		Dir:       relativeProjectDir(rootModule.SourceDir),
+		Backend:   rootModule.Backend.Type,
+		Modules:   []inventoryModule{},
+		Providers: []inventoryProvider{},
+	}
+
+	constraints := []string{}
+	for _, constraint := range rootModule.CoreVersionConstraints {
+		constraints = append(constraints, constraint.Required.String())
+	}
+	project.RequiredVersion = strings.Join(constraints, ", ")
+
+	for _, module := range append([]*configs.Module{rootModule}, loadLocalSubModules(rootModule)...) {
+		declaredIn := relativeProjectDir(module.SourceDir)
+
+		for name, mc := range module.ModuleCalls {
+			project.Modules = append(project.Modules, inventoryModule{
+				Name:       name,
+				Source:     mc.SourceAddr,
+				Version:    mc.Version.Required.String(),
+				DeclaredIn: declaredIn,
+			})
+		}
+
+		if module.ProviderRequirements == nil {
+			continue
+		}
+		for name, provider := range module.ProviderRequirements.RequiredProviders {
+			project.Providers = append(project.Providers, inventoryProvider{
+				Name:       name,
+				Source:     provider.Type.String(),
+				Version:    provider.Requirement.Required.String(),
+				DeclaredIn: declaredIn,
+			})
+		}
+	}
+
+	sort.Slice(project.Modules, func(i, j int) bool {
+		a, b := project.Modules[i], project.Modules[j]
+		if a.DeclaredIn != b.DeclaredIn {
+			return a.DeclaredIn < b.DeclaredIn
+		}
+		return a.Name < b.Name
+	})
+	sort.Slice(project.Providers, func(i, j int) bool {
+		a, b := project.Providers[i], project.Providers[j]
+		if a.DeclaredIn != b.DeclaredIn {
+			return a.DeclaredIn < b.DeclaredIn
+		}
+		return a.Name < b.Name
+	})
+
+	return project
+}
+
+// Writes the inventory as CSV, with one row per module call or provider requirement.
+// Projects without either get a single row, so every project shows up
+func writeInventoryCSV(cmd *cobra.Command, report inventoryReport) error {
+	writer := csv.NewWriter(cmd.OutOrStdout())
+	writer.Write([]string{"project", "backend", "required_version", "kind", "name", "source", "version", "declared_in"})
+
+	for _, project := range report.Projects {
+		row := func(kind, name, source, version, declaredIn string) {
+			writer.Write([]string{project.Dir, project.Backend, project.RequiredVersion, kind, name, source, version, declaredIn})
+		}
+
+		if len(project.Modules) == 0 && len(project.Providers) == 0 {
+			row("", "", "", "", "")
+		}
+		for _, module := range project.Modules {
+			row("module", module.Name, module.Source, module.Version, module.DeclaredIn)
+		}
+		for _, provider := range project.Providers {
+			row("provider", provider.Name, provider.Source, provider.Version, provider.DeclaredIn)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func exportInventory(cmd *cobra.Command, args []string) error {
+	if inventoryFormat != jsonFormat && inventoryFormat != csvFormat {
+		return fmt.Errorf("unknown --format %q, must be %s or %s", inventoryFormat, jsonFormat, csvFormat)
+	}
+	if err := resolveGitRoot(); err != nil {
+		return err
+	}
+
+	rootModules, err := FindRootModulesInPath(gitRoot)
+	if err != nil {
+		return err
+	}
+
+	report := inventoryReport{Projects: []inventoryProject{}}
+	for _, path := range rootModules {
+		module, _ := loadConfigDir(path)
+		report.Projects = append(report.Projects, buildInventory(module))
+	}
+	sort.Slice(report.Projects, func(i, j int) bool { return report.Projects[i].Dir < report.Projects[j].Dir })
+	log.Infof("Collected the inventory of %d root modules", len(report.Projects))
+
+	if inventoryFormat == csvFormat {
+		return writeInventoryCSV(cmd, report)
+	}
+
+	return writeJSON(cmd.OutOrStdout(), report)
+}
+
+var inventoryFormat string
+
+// inventoryCmd represents the inventory command
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Exports the modules, providers and versions used by every root module",
+	Long:  `Exports, per root module, its module calls with their sources and version constraints, its required providers and their constraints, its backend type and its required_version, as JSON or CSV`,
+	RunE:  exportInventory,
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+
+	addRepoFlags(inventoryCmd)
+	inventoryCmd.Flags().StringVar(&inventoryFormat, "format", jsonFormat, "Output format, json or csv")
+}
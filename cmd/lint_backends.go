@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/configs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Backend attributes that together identify where the state of a root module is stored
+type backendIdentitySchema struct {
+	// Attributes without which the state location is not known, usually because they are passed with -backend-config
+	required []string
+
+	// Attributes that are part of the location when set
+	optional []string
+
+	// Attribute holding the path of the state, expected to contain the project dir
+	key string
+}
+
+var backendIdentitySchemas = map[string]backendIdentitySchema{
+	"s3":         {required: []string{"bucket", "key"}, optional: []string{"workspace_key_prefix"}, key: "key"},
+	"gcs":        {required: []string{"bucket"}, optional: []string{"prefix"}, key: "prefix"},
+	"azurerm":    {required: []string{"storage_account_name", "container_name", "key"}, key: "key"},
+	"consul":     {required: []string{"path"}, optional: []string{"address"}, key: "path"},
+	"cos":        {required: []string{"bucket"}, optional: []string{"prefix", "key"}, key: "prefix"},
+	"oss":        {required: []string{"bucket"}, optional: []string{"prefix", "key"}, key: "prefix"},
+	"http":       {required: []string{"address"}},
+	"pg":         {required: []string{"conn_str"}, optional: []string{"schema_name"}},
+	"kubernetes": {required: []string{"secret_suffix"}, optional: []string{"namespace", "config_context"}},
+	"local":      {optional: []string{"path"}},
+}
+
+// Where a root module stores its state
+type backendIdentity struct {
+	// Project dir, relative to the repo root
+	dir string
+
+	backendType string
+
+	// Values of the identity attributes that are set
+	attributes map[string]string
+
+	declRange hcl.Range
+}
+
+// Formats the identity attributes in a stable order, like `bucket=b key=k`
+func (b backendIdentity) String() string {
+	names := []string{}
+	for name := range b.attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []string{}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, b.attributes[name]))
+	}
+
+	return b.backendType + " " + strings.Join(pairs, " ")
+}
+
+// A problem found by the backend lint
+type backendIssue struct {
+	// Errors always fail the lint, warnings only with --fail-on-warnings
+	isError bool
+
+	message string
+}
+
+func (i backendIssue) String() string {
+	if i.isError {
+		return "ERROR " + i.message
+	}
+	return "WARNING " + i.message
+}
+
+// Reads the identity of the backend of a root module. Returns false if its location can not be known statically
+func resolveBackendIdentity(module *configs.Module) (backendIdentity, bool) {
+	backend := module.Backend
+	identity := backendIdentity{
+		dir:         relativeProjectDir(module.SourceDir),
+		backendType: backend.Type,
+		attributes:  map[string]string{},
+		declRange:   backend.DeclRange,
+	}
+
+	schema, ok := backendIdentitySchemas[backend.Type]
+	if !ok {
+		log.Debugf("Not linting the %s backend of %s, as its identity attributes are unknown", backend.Type, identity.dir)
+		return identity, false
+	}
+
+	bodySchema := &hcl.BodySchema{}
+	for _, name := range append(append([]string{}, schema.required...), schema.optional...) {
+		bodySchema.Attributes = append(bodySchema.Attributes, hcl.AttributeSchema{Name: name})
+	}
+	content, _, _ := backend.Config.PartialContent(bodySchema)
+
+	for name, attr := range content.Attributes {
+		if value, ok := evalStaticString(attr.Expr, nil); ok {
+			identity.attributes[name] = value
+		}
+	}
+
+	for _, name := range schema.required {
+		if _, ok := identity.attributes[name]; !ok {
+			log.Debugf("Not linting the %s backend of %s, as %s is not set statically", backend.Type, identity.dir, name)
+			return identity, false
+		}
+	}
+
+	// The local state file is relative to the module, so its identity is the resolved path
+	if backend.Type == "local" {
+		path := identity.attributes["path"]
+		if path == "" {
+			path = "terraform.tfstate"
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(module.SourceDir, path)
+		}
+		if relativePath, ok := relativeToGitRoot(path); ok {
+			path = relativePath
+		}
+		identity.attributes["path"] = filepath.ToSlash(filepath.Clean(path))
+	}
+
+	return identity, true
+}
+
+// Finds root modules sharing the same state, and state keys which do not mention the project dir
+func lintBackendIdentities(identities []backendIdentity) []backendIssue {
+	issues := []backendIssue{}
+
+	byLocation := map[string][]backendIdentity{}
+	for _, identity := range identities {
+		byLocation[identity.String()] = append(byLocation[identity.String()], identity)
+	}
+
+	locations := []string{}
+	for location := range byLocation {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+
+	for _, location := range locations {
+		sharing := byLocation[location]
+		if len(sharing) < 2 {
+			continue
+		}
+		dirs := []string{}
+		for _, identity := range sharing {
+			dirs = append(dirs, fmt.Sprintf("%s (%s)", identity.dir, relativeRange(identity.declRange)))
+		}
+		issues = append(issues, backendIssue{
+			isError: true,
+			message: fmt.Sprintf("%d projects share the state %s: %s", len(sharing), location, strings.Join(dirs, ", ")),
+		})
+	}
+
+	for _, identity := range identities {
+		key := backendIdentitySchemas[identity.backendType].key
+		value, ok := identity.attributes[key]
+		if key == "" || !ok || identity.dir == "." {
+			continue
+		}
+		if !strings.Contains(value, identity.dir) {
+			issues = append(issues, backendIssue{
+				message: fmt.Sprintf("%s: %s backend %s %q does not contain the project dir (%s)", identity.dir, identity.backendType, key, value, relativeRange(identity.declRange)),
+			})
+		}
+	}
+
+	return issues
+}
+
+func lintBackends(cmd *cobra.Command, args []string) error {
+	if err := resolveGitRoot(); err != nil {
+		return err
+	}
+
+	rootModules, err := FindRootModulesInPath(gitRoot)
+	if err != nil {
+		return err
+	}
+
+	identities := []backendIdentity{}
+	for _, path := range rootModules {
+		module, _ := loadConfigDir(path)
+		if identity, ok := resolveBackendIdentity(module); ok {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].dir < identities[j].dir })
+
+	issues := lintBackendIdentities(identities)
+	failed := false
+	for _, issue := range issues {
+		fmt.Fprintln(cmd.OutOrStdout(), issue)
+		if issue.isError || failOnWarnings {
+			failed = true
+		}
+	}
+	log.Infof("Checked the backends of %d of %d root modules, found %d issues", len(identities), len(rootModules), len(issues))
+
+	if failed {
+		return fmt.Errorf("found %d backend issues", len(issues))
+	}
+
+	return nil
+}
+
+var failOnWarnings bool
+
+// lintBackendsCmd represents the lint-backends command
+var lintBackendsCmd = &cobra.Command{
+	Use:   "lint-backends",
+	Short: "Checks that no two root modules share the same state",
+	Long:  `Reports root modules whose backends point at the same state, and state keys that do not contain the project dir. Fails if any state is shared`,
+	RunE:  lintBackends,
+}
+
+func init() {
+	rootCmd.AddCommand(lintBackendsCmd)
+
+	addRepoFlags(lintBackendsCmd)
+	lintBackendsCmd.Flags().BoolVar(&failOnWarnings, "fail-on-warnings", false, "Also fails on state keys that do not contain the project dir")
+}
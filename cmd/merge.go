@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Comment marking a project of the old config that the generator must leave untouched
+const unmanagedProjectMarker = "managed: false"
+
+// Prefix of the comment listing the fields of a project that are overwritten on every run
+const generatedFieldsMarker = "generated:"
+
+// A project of the old config, as needed to merge a regenerated project into it
+type oldProject struct {
+	// The project entry with all of its comments
+	node *yaml.Node
+
+	// If the entry was marked with `# managed: false`
+	unmanaged bool
+
+	// `when_modified` entries carrying a comment, which were added by hand. Values are the comment nodes
+	commentedWhenModified map[string]*yaml.Node
+
+	// Fields listed in the `# generated:` comment of the entry, which the generator owned on the last run
+	generatedFields map[string]bool
+}
+
+// Everything needed to write the comments of a project in merge mode
+type projectAnnotation struct {
+	// Set for unmanaged projects, which are written exactly as they were
+	node *yaml.Node
+
+	// The project as produced by the generator, before merging
+	generated *AtlantisProject
+}
+
+// Reads the projects of the old config with their comments, by `dir`
+func readOldProjects(document *yaml.Node) map[string]oldProject {
+	projects := map[string]oldProject{}
+	if document == nil {
+		return projects
+	}
+
+	for _, item := range mappingValue(documentRoot(document), "projects").Content {
+		dir := mappingValue(item, "dir")
+		if dir.Value == "" {
+			continue
+		}
+
+		project := oldProject{node: item, commentedWhenModified: map[string]*yaml.Node{}, generatedFields: map[string]bool{}}
+
+		// The marker is either above the `- dir:` line or right after the dash
+		project.unmanaged = strings.Contains(item.HeadComment, unmanagedProjectMarker) ||
+			(len(item.Content) > 0 && strings.Contains(item.Content[0].HeadComment, unmanagedProjectMarker))
+
+		for _, line := range strings.Split(item.HeadComment, "\n") {
+			line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "#"))
+			if !strings.HasPrefix(line, generatedFieldsMarker) {
+				continue
+			}
+			for _, field := range strings.Split(strings.TrimPrefix(line, generatedFieldsMarker), ",") {
+				project.generatedFields[strings.TrimSpace(field)] = true
+			}
+		}
+
+		for _, entry := range mappingValue(mappingValue(item, "autoplan"), "when_modified").Content {
+			if entry.HeadComment != "" || entry.LineComment != "" || entry.FootComment != "" {
+				project.commentedWhenModified[entry.Value] = entry
+			}
+		}
+
+		projects[dir.Value] = project
+	}
+
+	return projects
+}
+
+// Merges a regenerated project into its entry in the old config. Fields set by the generator are overwritten.
+// Fields it does not set are kept, unless it owned them on the last run, as then they were removed from the locals.
+// `when_modified` entries added by hand are kept when they carry a comment, and every other dropped entry is logged
+func mergeProject(old AtlantisProject, generated AtlantisProject, meta oldProject) AtlantisProject {
+	merged := generated
+	merged.Autoplan.WhenModified = append([]string{}, generated.Autoplan.WhenModified...)
+
+	handWritten := func(field string) bool {
+		return !meta.generatedFields[field]
+	}
+
+	if merged.Name == "" && handWritten("name") {
+		merged.Name = old.Name
+	}
+	if merged.Workspace == "" && handWritten("workspace") {
+		merged.Workspace = old.Workspace
+	}
+	if merged.Workflow == "" && handWritten("workflow") {
+		merged.Workflow = old.Workflow
+	}
+	if merged.TerraformVersion == "" && handWritten("terraform_version") {
+		merged.TerraformVersion = old.TerraformVersion
+	}
+	if merged.TerraformDistribution == "" && handWritten("terraform_distribution") {
+		merged.TerraformDistribution = old.TerraformDistribution
+	}
+	if merged.ApplyRequirements == nil && handWritten("apply_requirements") {
+		merged.ApplyRequirements = old.ApplyRequirements
+	}
+	if merged.ExecutionOrderGroup == 0 && !executionOrderGroups && handWritten("execution_order_group") {
+		merged.ExecutionOrderGroup = old.ExecutionOrderGroup
+	}
+
+	generatedEntries := map[string]bool{}
+	for _, entry := range generated.Autoplan.WhenModified {
+		generatedEntries[entry] = true
+	}
+	for _, entry := range old.Autoplan.WhenModified {
+		if _, ok := meta.commentedWhenModified[entry]; ok {
+			merged.Autoplan.WhenModified = sliceUnion(merged.Autoplan.WhenModified, []string{entry})
+		} else if !generatedEntries[entry] {
+			log.Warnf("Dropping when_modified entry %q of project %s, as the generator no longer produces it. Add a comment to the entry to keep it", entry, old.Dir)
+		}
+	}
+
+	return merged
+}
+
+// Lists the fields of a project that were set by the generator
+func generatedFields(project *AtlantisProject) []string {
+	fields := []string{"dir", "autoplan"}
+	if project.Name != "" {
+		fields = append(fields, "name")
+	}
+	if project.Workspace != "" {
+		fields = append(fields, "workspace")
+	}
+	if project.Workflow != "" {
+		fields = append(fields, "workflow")
+	}
+	if project.TerraformVersion != "" {
+		fields = append(fields, "terraform_version")
+	}
+	if project.TerraformDistribution != "" {
+		fields = append(fields, "terraform_distribution")
+	}
+	if project.ApplyRequirements != nil {
+		fields = append(fields, "apply_requirements")
+	}
+	if project.ExecutionOrderGroup != 0 || executionOrderGroups {
+		fields = append(fields, "execution_order_group")
+	}
+
+	return fields
+}
+
+func documentRoot(document *yaml.Node) *yaml.Node {
+	if document.Kind == yaml.DocumentNode && len(document.Content) > 0 {
+		return document.Content[0]
+	}
+
+	return document
+}
+
+// Finds the value of a key in a mapping node. Returns an empty node if it can not be found,
+// so lookups can be chained
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node != nil && node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	}
+
+	return &yaml.Node{}
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/configs"
+)
+
+// Value of `terraform_distribution` for projects pinned to an OpenTofu version
+const openTofuDistribution = "opentofu"
+
+// OpenTofu configuration file extensions, mapped to the Terraform ones they take the place of
+var tofuFileExtensions = map[string]string{
+	".tofu":      ".tf",
+	".tofu.json": ".tf.json",
+}
+
+// Returns the configuration extension of a file name, or a blank string if it is not a configuration file
+func configFileExt(name string) string {
+	for _, ext := range []string{".tofu.json", ".tf.json", ".tofu", ".tf"} {
+		if strings.HasSuffix(name, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// Lists the primary and override configuration files of a directory the way OpenTofu does: `.tofu` and `.tofu.json`
+// files are read next to `.tf` and `.tf.json` files, and `x.tofu` replaces `x.tf` when both exist
+func configDirFiles(dir string) (primary []string, override []string, err error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Terraform files with an OpenTofu file of the same name
+	replaced := map[string]bool{}
+	for _, entry := range entries {
+		ext := configFileExt(entry.Name())
+		if tfExt, ok := tofuFileExtensions[ext]; ok && !entry.IsDir() {
+			replaced[strings.TrimSuffix(entry.Name(), ext)+tfExt] = true
+		}
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := configFileExt(name)
+		if entry.IsDir() || ext == "" || configs.IsIgnoredFile(name) || replaced[name] {
+			continue
+		}
+
+		baseName := strings.TrimSuffix(name, ext)
+		path := filepath.Join(dir, name)
+		if baseName == "override" || strings.HasSuffix(baseName, "_override") {
+			override = append(override, path)
+		} else {
+			primary = append(primary, path)
+		}
+	}
+
+	return primary, override, nil
+}
+
+// Checks if a directory directly contains Terraform or OpenTofu configuration files
+func isConfigDir(dir string) bool {
+	primary, override, _ := configDirFiles(dir)
+	return len(primary)+len(override) > 0
+}
+
+// Loads the files of a module with `parser`, following `configs.Parser.LoadConfigDir` but with the files
+// listed by `configDirFiles`. Returns a nil module if the directory can not be read
+func loadConfigDirFiles(parser *configs.Parser, path string) (*configs.Module, hcl.Diagnostics) {
+	primaryPaths, overridePaths, err := configDirFiles(path)
+	if err != nil {
+		return nil, hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  "Failed to read module directory",
+			Detail:   fmt.Sprintf("Module directory %s does not exist or cannot be read.", path),
+		}}
+	}
+
+	var diags hcl.Diagnostics
+	var primary, override []*configs.File
+	for _, filePath := range primaryPaths {
+		file, fileDiags := parser.LoadConfigFile(filePath)
+		diags = append(diags, fileDiags...)
+		if file != nil {
+			primary = append(primary, file)
+		}
+	}
+	for _, filePath := range overridePaths {
+		file, fileDiags := parser.LoadConfigFileOverride(filePath)
+		diags = append(diags, fileDiags...)
+		if file != nil {
+			override = append(override, file)
+		}
+	}
+
+	module, moduleDiags := configs.NewModule(primary, override)
+	diags = append(diags, moduleDiags...)
+	module.SourceDir = path
+
+	return module, diags
+}
+
+// Resolves the version pin of a project and its distribution, empty for Terraform. A version in the locals wins
+// over the flags, and each of them may pin either Terraform or OpenTofu but not both
+func resolveVersionPin(locals ResolvedLocals, origins map[string]string) (version string, distribution string, origin string, err error) {
+	switch {
+	case locals.TerraformVersion != "" && locals.TofuVersion != "":
+		return "", "", "", errors.New("atlantis.terraform_version and atlantis.tofu_version can not both be set")
+	case locals.TofuVersion != "":
+		return locals.TofuVersion, openTofuDistribution, origins["tofu_version"], nil
+	case locals.TerraformVersion != "":
+		return locals.TerraformVersion, "", origins["terraform_version"], nil
+	case defaultTerraformVersion != "" && defaultTofuVersion != "":
+		return "", "", "", errors.New("--terraform-version and --tofu-version can not both be set")
+	case defaultTofuVersion != "":
+		return defaultTofuVersion, openTofuDistribution, "--tofu-version flag", nil
+	}
+
+	return defaultTerraformVersion, "", "--terraform-version flag", nil
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	ghodssyaml "github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Comment line written below the header, recording how the file was generated. Also used to recognize
+// the header of an old config, so it is replaced instead of being kept as a user comment
+const commandLineCommentPrefix = "# Command: terraform-atlantis-config"
+
+// Flags left out of the recorded command line, as their values differ between machines
+var machineSpecificFlags = map[string]bool{
+	"root":   true,
+	"output": true,
+}
+
+// Builds the header comment of the output file. Returns an empty string if it was disabled
+func generatedHeader(cmd *cobra.Command) string {
+	if headerComment == "" {
+		return ""
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(headerComment, "\n") {
+		lines = append(lines, strings.TrimSpace("# "+line))
+	}
+
+	command := []string{strings.TrimPrefix(commandLineCommentPrefix, "# ")}
+	if cmd != nil {
+		command = append(command, cmd.Name())
+		cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+			if !flag.Changed || machineSpecificFlags[flag.Name] {
+				return
+			}
+			if slice, ok := flag.Value.(pflag.SliceValue); ok {
+				for _, value := range slice.GetSlice() {
+					command = append(command, fmt.Sprintf("--%s=%s", flag.Name, value))
+				}
+				return
+			}
+			if flag.Value.Type() == "bool" && flag.Value.String() == "true" {
+				command = append(command, "--"+flag.Name)
+				return
+			}
+			command = append(command, fmt.Sprintf("--%s=%s", flag.Name, flag.Value.String()))
+		})
+	}
+	lines = append(lines, "# "+strings.Join(command, " "))
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Removes the header written by a previous run from the contents of an old config
+func stripGeneratedHeader(contents []byte) []byte {
+	lines := strings.SplitAfter(string(contents), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		if strings.HasPrefix(line, commandLineCommentPrefix) {
+			return []byte(strings.Join(lines[i+1:], ""))
+		}
+	}
+
+	return contents
+}
+
+// Renders the config as YAML, after the header. By default keys are sorted and lists are not indented, as they
+// always were. With --keep-comments or --merge-projects, see `renderConfigWithComments`
+func renderConfig(config *AtlantisConfig, oldDocument *yaml.Node, annotations map[string]*projectAnnotation, header string) ([]byte, error) {
+	if keepComments || mergeProjects {
+		return renderConfigWithComments(config, oldDocument, annotations, header)
+	}
+
+	yamlBytes, err := ghodssyaml.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(header), yamlBytes...), nil
+}
+
+// Renders the config as YAML, with keys in the order of the config structs. Comments of the old config are
+// carried over to the sections preserved from it, and to the projects that were regenerated in their place
+func renderConfigWithComments(config *AtlantisConfig, oldDocument *yaml.Node, annotations map[string]*projectAnnotation, header string) ([]byte, error) {
+	root := &yaml.Node{}
+	if err := root.Encode(config); err != nil {
+		return nil, err
+	}
+
+	if oldDocument != nil {
+		oldRoot := documentRoot(oldDocument)
+		copyComments(oldRoot, root, "projects", "workflows")
+
+		// Workflows are written exactly as they were, keeping the order of their keys
+		if oldWorkflows := mappingValue(oldRoot, "workflows"); preserveWorkflows && oldWorkflows.Kind != 0 {
+			replaceMappingValue(root, "workflows", oldWorkflows)
+		}
+
+		// Projects kept by --preserve-projects or --since, or regenerated in place, keep their comments
+		oldProjects := map[string]*yaml.Node{}
+		for _, item := range mappingValue(oldRoot, "projects").Content {
+			oldProjects[mappingValue(item, "dir").Value] = item
+		}
+		for _, item := range mappingValue(root, "projects").Content {
+			if old, ok := oldProjects[mappingValue(item, "dir").Value]; ok {
+				copyComments(old, item)
+			}
+		}
+	}
+
+	projects := mappingValue(root, "projects")
+	for i, item := range projects.Content {
+		annotation, ok := annotations[mappingValue(item, "dir").Value]
+		if !ok {
+			continue
+		}
+
+		if annotation.node != nil {
+			projects.Content[i] = annotation.node
+			continue
+		}
+
+		item.HeadComment = withGeneratedFieldsMarker(item.HeadComment, generatedFields(annotation.generated))
+	}
+
+	buffer := bytes.Buffer{}
+	buffer.WriteString(header)
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Copies the comments of a node and its children onto a node generated for the same data. Mapping entries are
+// matched by key and scalar sequence entries by value. Entries under the skipped keys are left alone
+func copyComments(old *yaml.Node, generated *yaml.Node, skippedKeys ...string) {
+	generated.HeadComment = old.HeadComment
+	generated.LineComment = old.LineComment
+	generated.FootComment = old.FootComment
+
+	if old.Kind != generated.Kind {
+		return
+	}
+
+	switch generated.Kind {
+	case yaml.MappingNode:
+		skipped := map[string]bool{}
+		for _, key := range skippedKeys {
+			skipped[key] = true
+		}
+
+		for i := 0; i+1 < len(generated.Content); i += 2 {
+			key := generated.Content[i]
+			for j := 0; j+1 < len(old.Content); j += 2 {
+				if old.Content[j].Value != key.Value {
+					continue
+				}
+				copyComments(old.Content[j], key)
+				if !skipped[key.Value] {
+					copyComments(old.Content[j+1], generated.Content[i+1])
+				}
+				break
+			}
+		}
+	case yaml.SequenceNode:
+		for _, entry := range generated.Content {
+			if entry.Kind != yaml.ScalarNode {
+				continue
+			}
+			for _, oldEntry := range old.Content {
+				if oldEntry.Kind == yaml.ScalarNode && oldEntry.Value == entry.Value {
+					copyComments(oldEntry, entry)
+					break
+				}
+			}
+		}
+	}
+}
+
+// Replaces the marker listing the generated fields in a head comment, keeping any other comment lines
+func withGeneratedFieldsMarker(comment string, fields []string) string {
+	lines := []string{}
+	for _, line := range strings.Split(comment, "\n") {
+		if line != "" && !strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(line, "#")), generatedFieldsMarker) {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(append(lines, "# "+generatedFieldsMarker+" "+strings.Join(fields, ", ")), "\n")
+}
+
+func replaceMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+}
+
+// Writes a report as indented JSON. Version constraints like `>= 1.0` are kept readable instead of HTML escaped
+func writeJSON(out io.Writer, report interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(report)
+}
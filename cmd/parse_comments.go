@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Text an annotation comment starts with, after the comment marker
+const annotationPrefix = "atlantis:"
+
+// The settings of the annotation comments in one file
+type commentAnnotations struct {
+	file string
+
+	// Values by setting name, as they would be in the `atlantis` local
+	values map[string]cty.Value
+
+	// Comment each setting was read from
+	ranges map[string]hcl.Range
+}
+
+// Matches whole numbers, the only numbers annotations know about, as versions like `1.5` are strings
+var annotationNumberRegex = regexp.MustCompile(`^-?[0-9]+$`)
+
+var commentAnnotationsCache sync.Map
+
+// Reads the annotation comments, like `# atlantis: workflow=prod autoplan=false`, of the native syntax configuration
+// files in `dir`, in file order. They set the same settings as the `atlantis` local, for modules where an unused local
+// upsets linters. A setting annotated twice keeps its first value, and unknown settings are ignored
+func readCommentAnnotations(dir string) []commentAnnotations {
+	if cached, ok := commentAnnotationsCache.Load(dir); ok {
+		return cached.([]commentAnnotations)
+	}
+
+	primary, override, _ := configDirFiles(dir)
+
+	var annotations []commentAnnotations
+	seen := map[string]hcl.Range{}
+	for _, path := range append(primary, override...) {
+		if strings.HasSuffix(path, ".json") {
+			continue
+		}
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		fileAnnotations := commentAnnotations{file: path, values: map[string]cty.Value{}, ranges: map[string]hcl.Range{}}
+		tokens, _ := hclsyntax.LexConfig(src, path, hcl.InitialPos)
+		for _, token := range tokens {
+			if token.Type != hclsyntax.TokenComment {
+				continue
+			}
+			text, ok := annotationText(string(token.Bytes))
+			if !ok {
+				continue
+			}
+
+			settings, err := parseAnnotation(text)
+			if err != nil {
+				log.Warnf("Ignoring annotation at %s: %s", relativeRange(token.Range), err)
+				continue
+			}
+			for _, setting := range settings {
+				if !atlantisSettingNames[setting.name] {
+					log.Warnf("Ignoring unknown setting %s annotated at %s", setting.name, relativeRange(token.Range))
+					continue
+				}
+				if previous, ok := seen[setting.name]; ok {
+					log.Warnf("Ignoring %s annotated at %s, as it was already annotated at %s", setting.name, relativeRange(token.Range), relativeRange(previous))
+					continue
+				}
+				seen[setting.name] = token.Range
+				fileAnnotations.values[setting.name] = setting.value
+				fileAnnotations.ranges[setting.name] = token.Range
+			}
+		}
+
+		if len(fileAnnotations.values) > 0 {
+			annotations = append(annotations, fileAnnotations)
+		}
+	}
+
+	commentAnnotationsCache.Store(dir, annotations)
+	return annotations
+}
+
+// Strips the comment marker and the annotation prefix from a single line comment
+func annotationText(comment string) (string, bool) {
+	comment = strings.TrimSpace(comment)
+	switch {
+	case strings.HasPrefix(comment, "#"):
+		comment = strings.TrimPrefix(comment, "#")
+	case strings.HasPrefix(comment, "//"):
+		comment = strings.TrimPrefix(comment, "//")
+	default:
+		return "", false
+	}
+
+	comment = strings.TrimSpace(comment)
+	if !strings.HasPrefix(comment, annotationPrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(comment, annotationPrefix), true
+}
+
+type annotationSetting struct {
+	name  string
+	value cty.Value
+}
+
+// Parses the `name=value` pairs of an annotation, separated by spaces. Values are strings, unless they are
+// `true`, `false`, whole numbers, or HCL lists and quoted strings like `["approved", "mergeable"]`
+func parseAnnotation(text string) ([]annotationSetting, error) {
+	pairs, err := splitAnnotation(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("no settings, expected name=value pairs")
+	}
+
+	settings := []annotationSetting{}
+	for _, pair := range pairs {
+		name, raw := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			name, raw = pair[:i], pair[i+1:]
+		}
+		if name == "" || raw == "" {
+			return nil, fmt.Errorf("%q is not a name=value pair", pair)
+		}
+
+		value, err := annotationValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %s", name, err)
+		}
+		settings = append(settings, annotationSetting{name: name, value: value})
+	}
+
+	return settings, nil
+}
+
+func annotationValue(raw string) (cty.Value, error) {
+	switch {
+	case raw == "true":
+		return cty.True, nil
+	case raw == "false":
+		return cty.False, nil
+	case annotationNumberRegex.MatchString(raw):
+		return cty.ParseNumberVal(raw)
+	case strings.HasPrefix(raw, "[") || strings.HasPrefix(raw, `"`):
+		expr, diags := hclsyntax.ParseExpression([]byte(raw), "", hcl.InitialPos)
+		if diags.HasErrors() {
+			return cty.NilVal, errors.New(diags[0].Summary)
+		}
+		value, diags := expr.Value(nil)
+		if diags.HasErrors() {
+			return cty.NilVal, errors.New(diags[0].Summary)
+		}
+		return value, nil
+	}
+
+	return cty.StringVal(raw), nil
+}
+
+// Splits an annotation on spaces outside of quotes and brackets
+func splitAnnotation(text string) ([]string, error) {
+	var pairs []string
+	var current strings.Builder
+	depth := 0
+	quoted := false
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(text):
+			current.WriteByte(c)
+			i++
+			c = text[i]
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == '[':
+			depth++
+		case !quoted && c == ']':
+			depth--
+		case !quoted && depth == 0 && (c == ' ' || c == '\t'):
+			if current.Len() > 0 {
+				pairs = append(pairs, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		current.WriteByte(c)
+	}
+
+	if quoted || depth != 0 {
+		return nil, fmt.Errorf("unterminated quote or bracket")
+	}
+	if current.Len() > 0 {
+		pairs = append(pairs, current.String())
+	}
+
+	return pairs, nil
+}
+
+// Resolves the settings of the annotation comments of a module, together with the comment each setting
+// was read from. Locals take precedence over these, see `mergeLocals`
+func resolveCommentAnnotations(dir string) (ResolvedLocals, map[string]hcl.Range) {
+	values := map[string]cty.Value{}
+	ranges := map[string]hcl.Range{}
+	for _, annotations := range readCommentAnnotations(dir) {
+		for name, value := range annotations.values {
+			values[name] = value
+			ranges[name] = annotations.ranges[name]
+		}
+	}
+
+	return resolveAtlantisValues(values, ranges), ranges
+}
+
+// Fills the settings `locals` does not set from `fallback`. Both version pins count as one setting,
+// so a Terraform version in the locals is not at odds with an OpenTofu version in the fallback
+func mergeLocals(locals ResolvedLocals, fallback ResolvedLocals) ResolvedLocals {
+	if locals.AtlantisWorkflow == "" {
+		locals.AtlantisWorkflow = fallback.AtlantisWorkflow
+	}
+	if locals.ApplyRequirements == nil {
+		locals.ApplyRequirements = fallback.ApplyRequirements
+	}
+	if locals.ExtraAtlantisDependencies == nil {
+		locals.ExtraAtlantisDependencies = fallback.ExtraAtlantisDependencies
+	}
+	if locals.AutoPlanFileList == nil {
+		locals.AutoPlanFileList = fallback.AutoPlanFileList
+	}
+	if locals.WhenModifiedExclude == nil {
+		locals.WhenModifiedExclude = fallback.WhenModifiedExclude
+	}
+	if locals.AutoPlan == nil {
+		locals.AutoPlan = fallback.AutoPlan
+	}
+	if locals.Skip == nil {
+		locals.Skip = fallback.Skip
+	}
+	if locals.TerraformVersion == "" && locals.TofuVersion == "" {
+		locals.TerraformVersion = fallback.TerraformVersion
+		locals.TofuVersion = fallback.TofuVersion
+	}
+	if locals.ProjectType == "" {
+		locals.ProjectType = fallback.ProjectType
+	}
+	if locals.ExecutionOrderGroup == nil {
+		locals.ExecutionOrderGroup = fallback.ExecutionOrderGroup
+	}
+
+	return locals
+}
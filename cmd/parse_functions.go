@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform/configs"
+	"github.com/hashicorp/terraform/lang"
+	log "github.com/sirupsen/logrus"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Terraform functions that read files from disk. The first argument of each of them is a path
+var fileFunctionNames = map[string]bool{
+	"file":         true,
+	"filebase64":   true,
+	"templatefile": true,
+	"fileset":      true,
+}
+
+// Finds all files read by file functions in the resources, data sources, locals and module arguments
+// of a root module and its local sub modules, as loaded by `loadStaticModules`. Returns absolute paths or globs
+func parseTerraformFileFunctions(rootModule *configs.Module, modules []staticModule) ([]dependency, error) {
+	var sourceMap = map[string]dependency{}
+
+	for _, static := range modules {
+		for _, call := range findFileFunctionCalls(static.module) {
+			path, ok := resolveFileFunctionPath(call, static.ctx)
+			if !ok {
+				log.Debugf("Could not statically resolve %s() at %s", call.Name, call.Range())
+				continue
+			}
+
+			// Relative paths in file functions are relative to the working directory, which is the root module
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(rootModule.SourceDir, path)
+			}
+			addDependency(sourceMap, dependency{
+				path:      filepath.ToSlash(filepath.Clean(path)),
+				mechanism: mechanismFileFunction,
+				detail:    call.Name + "()",
+				source:    call.Range(),
+			})
+		}
+	}
+
+	return sortedDependencies(sourceMap), nil
+}
+
+// Collects every call to a file function in the given module
+func findFileFunctionCalls(module *configs.Module) []*hclsyntax.FunctionCallExpr {
+	var calls []*hclsyntax.FunctionCallExpr
+	visit := func(node hclsyntax.Node) hcl.Diagnostics {
+		if call, ok := node.(*hclsyntax.FunctionCallExpr); ok && fileFunctionNames[call.Name] {
+			calls = append(calls, call)
+		}
+		return nil
+	}
+
+	// Bodies and expressions from .tf.json files are not hclsyntax nodes and can not be walked
+	walkBody := func(body hcl.Body) {
+		if syntaxBody, ok := body.(*hclsyntax.Body); ok {
+			hclsyntax.VisitAll(syntaxBody, visit)
+		}
+	}
+
+	for _, resource := range module.ManagedResources {
+		walkBody(resource.Config)
+	}
+	for _, resource := range module.DataResources {
+		walkBody(resource.Config)
+	}
+	for _, mc := range module.ModuleCalls {
+		walkBody(mc.Config)
+	}
+	for _, local := range module.Locals {
+		if expr, ok := local.Expr.(hclsyntax.Expression); ok {
+			hclsyntax.VisitAll(expr, visit)
+		}
+	}
+
+	return calls
+}
+
+// Evaluates the path argument of a file function call. `fileset` calls resolve to a glob
+func resolveFileFunctionPath(call *hclsyntax.FunctionCallExpr, ctx *hcl.EvalContext) (string, bool) {
+	if len(call.Args) == 0 {
+		return "", false
+	}
+
+	path, ok := evalStaticString(call.Args[0], ctx)
+	if !ok {
+		return "", false
+	}
+
+	if call.Name == "fileset" {
+		pattern := "**"
+		if len(call.Args) > 1 {
+			if value, ok := evalStaticString(call.Args[1], ctx); ok {
+				pattern = value
+			}
+		}
+		path = joinPath(path, pattern)
+	}
+
+	return path, true
+}
+
+func evalStaticString(expr hcl.Expression, ctx *hcl.EvalContext) (string, bool) {
+	value, diags := expr.Value(ctx)
+	if diags.HasErrors() || !value.IsWhollyKnown() || value.IsNull() || !value.Type().Equals(cty.String) {
+		return "", false
+	}
+
+	return value.AsString(), true
+}
+
+// Builds an evaluation context with everything that can be known without running Terraform:
+// the `path` object, pure functions and locals that only depend on those two
+func staticEvalContext(module *configs.Module, rootDir string) *hcl.EvalContext {
+	scope := &lang.Scope{BaseDir: rootDir, PureOnly: true}
+	ctx := &hcl.EvalContext{
+		Functions: scope.Functions(),
+		Variables: map[string]cty.Value{
+			"path": cty.ObjectVal(map[string]cty.Value{
+				"module": cty.StringVal(filepath.ToSlash(module.SourceDir)),
+				"root":   cty.StringVal(filepath.ToSlash(rootDir)),
+				"cwd":    cty.StringVal(filepath.ToSlash(rootDir)),
+			}),
+		},
+	}
+
+	// Locals may reference each other, so keep resolving until no more of them can be evaluated
+	locals := map[string]cty.Value{}
+	for resolved := true; resolved; {
+		resolved = false
+		ctx.Variables["local"] = cty.ObjectVal(locals)
+		for name, local := range module.Locals {
+			if _, done := locals[name]; done {
+				continue
+			}
+			value, diags := local.Expr.Value(ctx)
+			if diags.HasErrors() || !value.IsWhollyKnown() {
+				continue
+			}
+			locals[name] = value
+			resolved = true
+		}
+	}
+	ctx.Variables["local"] = cty.ObjectVal(locals)
+
+	return ctx
+}
+
+// A module of a project with its static evaluation context, shared by the scanners of file functions and path attributes
+type staticModule struct {
+	module *configs.Module
+	ctx    *hcl.EvalContext
+}
+
+// Loads the local sub modules of a root module and builds the evaluation contexts of all of them, once per project
+func loadStaticModules(rootModule *configs.Module) []staticModule {
+	modules := []staticModule{}
+	for _, module := range append([]*configs.Module{rootModule}, loadLocalSubModules(rootModule)...) {
+		modules = append(modules, staticModule{module: module, ctx: staticEvalContext(module, rootModule.SourceDir)})
+	}
+
+	return modules
+}
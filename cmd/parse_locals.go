@@ -5,9 +5,17 @@ package cmd
 // parses the `locals` blocks and evaluates their contents.
 
 import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/terraform/configs"
+	log "github.com/sirupsen/logrus"
 	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 // ResolvedLocals are the parsed result of local values this module cares about
@@ -21,6 +29,12 @@ type ResolvedLocals struct {
 	// Extra dependencies that can be hardcoded in config
 	ExtraAtlantisDependencies []string
 
+	// Globs of module-local files to override the global `--autoplan-file-list` flag
+	AutoPlanFileList []string
+
+	// Globs of module-local files that never trigger a plan, to override the global `--when-modified-exclude` flag
+	WhenModifiedExclude []string
+
 	// If set, a single module will have autoplan turned to this setting
 	AutoPlan *bool
 
@@ -30,10 +44,17 @@ type ResolvedLocals struct {
 	// Terraform version to use just for this project
 	TerraformVersion string
 
+	// OpenTofu version to use just for this project, instead of a Terraform one
+	TofuVersion string
+
+	// Project type deciding the default files that trigger a plan
+	ProjectType string
+
 	// If set to true, create Atlantis project
 	markedProject *bool
 
-	ExecutionOrderGroup int
+	// Execution order group pinned for this project
+	ExecutionOrderGroup *int
 }
 
 func resolveLocals(module *configs.Module) ResolvedLocals {
@@ -50,12 +71,47 @@ func resolveLocals(module *configs.Module) ResolvedLocals {
 	if diag.HasErrors() {
 		return resolved
 	}
+
 	values := atlantisValues.AsValueMap()
+	subjects := map[string]hcl.Range{}
+	for name := range values {
+		subjects[name] = atlantisMap.DeclRange
+	}
+
+	return resolveAtlantisValues(values, subjects)
+}
+
+// Names of the settings read by `resolveAtlantisValues`
+var atlantisSettingNames = map[string]bool{
+	"workflow":              true,
+	"execution_order_group": true,
+	"terraform_version":     true,
+	"tofu_version":          true,
+	"project_type":          true,
+	"autoplan":              true,
+	"skip":                  true,
+	"apply_requirements":    true,
+	"extra_dependencies":    true,
+	"autoplan_file_list":    true,
+	"when_modified_exclude": true,
+}
+
+// Extracts the settings from the values of an `atlantis` local or of `# atlantis:` comments, with `subjects`
+// telling where each setting was read from. Values of an unexpected type are ignored, and so are the elements
+// of lists that are not strings, which are reported as diagnostics
+func resolveAtlantisValues(values map[string]cty.Value, subjects map[string]hcl.Range) ResolvedLocals {
+	resolved := ResolvedLocals{}
+	subject := func(name string) *hcl.Range {
+		if r, ok := subjects[name]; ok {
+			return r.Ptr()
+		}
+		return nil
+	}
 
 	workflowValue, ok := values["workflow"]
 	if ok {
-		if workflowValue.Type().IsPrimitiveType() {
-			resolved.AtlantisWorkflow = workflowValue.AsString()
+		if value, ok := primitiveString(workflowValue); ok {
+			resolved.AtlantisWorkflow = value
 		}
 	}
 
@@ -63,14 +119,29 @@ func resolveLocals(module *configs.Module) ResolvedLocals {
 	if ok {
 		if executionOrderGroup.Type().Equals(cty.Number) {
 			intValue, _ := executionOrderGroup.AsBigFloat().Int64()
-			resolved.ExecutionOrderGroup = int(intValue)
+			group := int(intValue)
+			resolved.ExecutionOrderGroup = &group
 		}
 	}
 
 	versionValue, ok := values["terraform_version"]
 	if ok {
-		if versionValue.Type().IsPrimitiveType() {
-			resolved.TerraformVersion = versionValue.AsString()
+		if value, ok := primitiveString(versionValue); ok {
+			resolved.TerraformVersion = value
+		}
+	}
+
+	tofuVersionValue, ok := values["tofu_version"]
+	if ok {
+		if value, ok := primitiveString(tofuVersionValue); ok {
+			resolved.TofuVersion = value
+		}
+	}
+
+	projectTypeValue, ok := values["project_type"]
+	if ok {
+		if value, ok := primitiveString(projectTypeValue); ok {
+			resolved.ProjectType = value
 		}
 	}
 
@@ -93,24 +164,187 @@ func resolveLocals(module *configs.Module) ResolvedLocals {
 	applyReqs, ok := values["apply_requirements"]
 	if ok {
 		if applyReqs.Type().IsTupleType() {
-			it := applyReqs.ElementIterator()
-			for it.Next() {
-				_, val := it.Element()
-				resolved.ApplyRequirements = append(resolved.ApplyRequirements, filepath.ToSlash(val.AsString()))
-			}
+			resolved.ApplyRequirements = append(resolved.ApplyRequirements, stringList(applyReqs, "apply_requirements", subject("apply_requirements"))...)
 		}
 	}
 
 	extraDependencies, ok := values["extra_dependencies"]
 	if ok {
 		if extraDependencies.Type().IsTupleType() {
-			it := extraDependencies.ElementIterator()
-			for it.Next() {
-				_, val := it.Element()
-				resolved.ExtraAtlantisDependencies = append(resolved.ExtraAtlantisDependencies, filepath.ToSlash(val.AsString()))
-			}
+			resolved.ExtraAtlantisDependencies = append(resolved.ExtraAtlantisDependencies, stringList(extraDependencies, "extra_dependencies", subject("extra_dependencies"))...)
+		}
+	}
+
+	autoPlanFileList, ok := values["autoplan_file_list"]
+	if ok {
+		if autoPlanFileList.Type().IsTupleType() {
+			resolved.AutoPlanFileList = stringList(autoPlanFileList, "autoplan_file_list", subject("autoplan_file_list"))
+		}
+	}
+
+	whenModifiedExclude, ok := values["when_modified_exclude"]
+	if ok {
+		if whenModifiedExclude.Type().IsTupleType() {
+			resolved.WhenModifiedExclude = stringList(whenModifiedExclude, "when_modified_exclude", subject("when_modified_exclude"))
 		}
 	}
 
 	return resolved
 }
+
+// Reads the elements of a list setting, skipping the ones that are not strings
+func stringList(value cty.Value, name string, subject *hcl.Range) []string {
+	list := []string{}
+	it := value.ElementIterator()
+	for i := 0; it.Next(); i++ {
+		_, val := it.Element()
+		if !val.Type().Equals(cty.String) || val.IsNull() || !val.IsKnown() {
+			reportInvalidSetting(subject, fmt.Sprintf("Element %d of atlantis.%s is not a string", i, name))
+			continue
+		}
+		list = append(list, filepath.ToSlash(val.AsString()))
+	}
+
+	return list
+}
+
+// Records a diagnostic about an ignored setting, and logs it the first time it is found
+func reportInvalidSetting(subject *hcl.Range, detail string) {
+	added := collectedDiagnostics.add(nil, hcl.Diagnostics{{
+		Severity: hcl.DiagWarning,
+		Summary:  "Invalid atlantis setting",
+		Detail:   detail,
+		Subject:  subject,
+	}})
+	if added == 0 {
+		return
+	}
+
+	if subject != nil {
+		log.Warnf("%s at %s, ignoring it", detail, relativeRange(*subject))
+	} else {
+		log.Warnf("%s, ignoring it", detail)
+	}
+}
+
+// Converts a primitive value to a string, so `terraform_version = 1.5` reads as "1.5"
+func primitiveString(value cty.Value) (string, bool) {
+	if !value.Type().IsPrimitiveType() || value.IsNull() || !value.IsKnown() {
+		return "", false
+	}
+	converted, err := convert.Convert(value, cty.String)
+	if err != nil {
+		return "", false
+	}
+
+	return converted.AsString(), true
+}
+
+// Name of the marker file that can hold an `atlantis` local for a directory without touching its Terraform code
+const atlantisMarkerFileName = ".atlantis.hcl"
+
+// InheritedLocals are the cascading settings a module inherits from the directories above it
+type InheritedLocals struct {
+	// If set to true, the module will not be included in the output
+	Skip *bool
+
+	// The file `Skip` was set in
+	SkipSource string
+
+	// If set, the module will have autoplan turned to this setting
+	AutoPlan *bool
+
+	// The file `AutoPlan` was set in
+	AutoPlanSource string
+}
+
+// An `atlantis` local together with the file it was declared in
+type localsSource struct {
+	locals ResolvedLocals
+	file   string
+}
+
+// The locals a single directory passes down to the directories below it
+type directoryLocals struct {
+	// From the .tf and .tofu files in the directory
+	module *localsSource
+
+	// From annotation comments in those files, one per file
+	comments []*localsSource
+
+	// From the marker file in the directory
+	marker *localsSource
+}
+
+var directoryLocalsCache sync.Map
+
+// Resolves the cascading settings of the module in `dir` from the nearest ancestor setting them. The marker file
+// of `dir` itself counts as its nearest ancestor. In each directory, locals in .tf and .tofu files win over
+// annotation comments, which win over the marker file
+func resolveInheritedLocals(dir string) InheritedLocals {
+	inherited := InheritedLocals{}
+
+	dir = filepath.Clean(dir)
+	root := filepath.Clean(gitRoot)
+	for current := dir; ; current = filepath.Dir(current) {
+		dirLocals := loadDirectoryLocals(current)
+
+		sources := []*localsSource{dirLocals.marker}
+		if current != dir {
+			sources = append(append([]*localsSource{dirLocals.module}, dirLocals.comments...), dirLocals.marker)
+		}
+
+		for _, source := range sources {
+			if source == nil {
+				continue
+			}
+			if inherited.Skip == nil && source.locals.Skip != nil {
+				inherited.Skip = source.locals.Skip
+				inherited.SkipSource = source.file
+			}
+			if inherited.AutoPlan == nil && source.locals.AutoPlan != nil {
+				inherited.AutoPlan = source.locals.AutoPlan
+				inherited.AutoPlanSource = source.file
+			}
+		}
+
+		if current == root || filepath.Dir(current) == current || !strings.HasPrefix(current, root) {
+			break
+		}
+	}
+
+	return inherited
+}
+
+func loadDirectoryLocals(dir string) directoryLocals {
+	if cached, ok := directoryLocalsCache.Load(dir); ok {
+		return cached.(directoryLocals)
+	}
+
+	dirLocals := directoryLocals{}
+
+	if isConfigDir(dir) {
+		module, _ := loadConfigDir(dir)
+		if local, ok := module.Locals["atlantis"]; ok {
+			dirLocals.module = &localsSource{locals: resolveLocals(module), file: local.DeclRange.Filename}
+		}
+		for _, annotations := range readCommentAnnotations(dir) {
+			dirLocals.comments = append(dirLocals.comments, &localsSource{locals: resolveAtlantisValues(annotations.values, annotations.ranges), file: annotations.file})
+		}
+	}
+
+	markerFile := filepath.Join(dir, atlantisMarkerFileName)
+	if _, err := os.Stat(markerFile); err == nil {
+		file, diags := loadConfigFile(markerFile)
+		if diags.HasErrors() {
+			log.Warnf("Failed to parse %s: %s", markerFile, diags.Error())
+		}
+		if file != nil {
+			module, _ := configs.NewModule([]*configs.File{file}, nil)
+			dirLocals.marker = &localsSource{locals: resolveLocals(module), file: markerFile}
+		}
+	}
+
+	directoryLocalsCache.Store(dir, dirLocals)
+	return dirLocals
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/terraform/configs"
+	log "github.com/sirupsen/logrus"
+)
+
+// Resource and data source attributes holding paths to local files or directories, in the `type.attribute` format.
+// The same table applies to both managed resources and data sources
+var builtinPathAttributes = []string{
+	"archive_file.source_dir",
+	"archive_file.source_file",
+	"local_file.source",
+	"local_sensitive_file.source",
+	"helm_release.chart",
+	"kubectl_path_documents.pattern",
+	"kubectl_filename_list.pattern",
+	"kustomization_build.path",
+}
+
+// Groups `type.attribute` entries by resource type
+func pathAttributesByType() map[string][]string {
+	byType := map[string][]string{}
+	for _, entry := range append(builtinPathAttributes, extraPathAttributes...) {
+		i := strings.LastIndex(entry, ".")
+		if i <= 0 || i == len(entry)-1 {
+			log.Warnf("Ignoring path attribute %q, expected the `type.attribute` format", entry)
+			continue
+		}
+		byType[entry[:i]] = append(byType[entry[:i]], entry[i+1:])
+	}
+
+	return byType
+}
+
+// Finds all local paths referenced by known path attributes in the resources and data sources
+// of a root module and its local sub modules, as loaded by `loadStaticModules`. Returns absolute paths or globs
+func parseTerraformPathAttributes(rootModule *configs.Module, modules []staticModule) ([]dependency, error) {
+	var sourceMap = map[string]dependency{}
+	attributesByType := pathAttributesByType()
+
+	for _, static := range modules {
+		resources := []*configs.Resource{}
+		for _, resource := range static.module.ManagedResources {
+			resources = append(resources, resource)
+		}
+		for _, resource := range static.module.DataResources {
+			resources = append(resources, resource)
+		}
+
+		for _, resource := range resources {
+			attributes, ok := attributesByType[resource.Type]
+			if !ok {
+				continue
+			}
+
+			schema := &hcl.BodySchema{}
+			for _, name := range attributes {
+				schema.Attributes = append(schema.Attributes, hcl.AttributeSchema{Name: name})
+			}
+			content, _, _ := resource.Config.PartialContent(schema)
+
+			for _, attr := range content.Attributes {
+				path, ok := evalStaticString(attr.Expr, static.ctx)
+				if !ok {
+					log.Debugf("Could not statically resolve %s.%s at %s", resource.Type, attr.Name, attr.Range)
+					continue
+				}
+
+				source, ok := localPathDependency(path, rootModule.SourceDir)
+				if !ok {
+					log.Debugf("Ignoring %s.%s = %q at %s, as it is not a local path", resource.Type, attr.Name, path, attr.Range)
+					continue
+				}
+				addDependency(sourceMap, dependency{
+					path:      source,
+					mechanism: mechanismPathAttribute,
+					detail:    resource.Addr().String() + "." + attr.Name,
+					source:    attr.Range,
+				})
+			}
+		}
+	}
+
+	return sortedDependencies(sourceMap), nil
+}
+
+// Turns a path value into a `when_modified` entry. Directories include everything below them and globs are kept as is.
+// Values which do not exist on disk, like Helm charts from a remote repository, are not local paths
+func localPathDependency(path string, rootDir string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootDir, path)
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+
+	if isGlob(path) {
+		return path, true
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	if info.IsDir() {
+		return joinPath(path, "**"), true
+	}
+
+	return path, true
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Finds the `//subdir` of a git or GitHub module source pointing at this very repo, as identified by `--repo-url`.
+// For example `git::ssh://git@github.com/org/infra.git//modules/vpc?ref=main` resolves to `modules/vpc`
+func sameRepoModuleSubDir(source string) (string, bool) {
+	if len(repoURLs) == 0 {
+		return "", false
+	}
+
+	source = strings.TrimPrefix(source, "git::")
+	if i := strings.Index(source, "?"); i >= 0 {
+		source = source[:i]
+	}
+
+	// The subdir separator is the first `//` after the scheme, if there is any
+	offset := 0
+	if i := strings.Index(source, "://"); i >= 0 {
+		offset = i + len("://")
+	}
+	repo, subDir := source, ""
+	if i := strings.Index(source[offset:], "//"); i >= 0 {
+		repo = source[:offset+i]
+		subDir = source[offset+i+len("//"):]
+	}
+
+	if !isThisRepo(repo) {
+		return "", false
+	}
+
+	if cleaned := path.Clean(subDir); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		log.Warnf("Ignoring module source %s, as its subdir %s leaves the repo", source, subDir)
+		return "", false
+	}
+
+	return subDir, true
+}
+
+func isThisRepo(url string) bool {
+	normalized := normalizeRepoURL(url)
+	for _, pattern := range repoURLs {
+		matched, err := path.Match(normalizeRepoURL(pattern), normalized)
+		if err != nil {
+			log.Warnf("Ignoring malformed repo url pattern %q: %s", pattern, err)
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Reduces the different ways of addressing a repo to `host/owner/repo`, so that
+// `git@github.com:org/infra.git`, `https://github.com/org/infra` and `github.com/org/infra` are all equal
+func normalizeRepoURL(url string) string {
+	url = strings.TrimPrefix(url, "git::")
+	hasScheme := false
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+len("://"):]
+		hasScheme = true
+	}
+
+	// Drop any user info, like `git@`
+	if i := strings.Index(url, "@"); i >= 0 && (strings.Index(url, "/") < 0 || i < strings.Index(url, "/")) {
+		url = url[i+1:]
+	}
+
+	// A colon in the host is a port in URLs like `ssh://github.com:22/org/infra`, but separates the path
+	// in scp-like addresses like `github.com:org/infra`
+	if i := strings.Index(url, ":"); i >= 0 && (strings.Index(url, "/") < 0 || i < strings.Index(url, "/")) {
+		if hasScheme {
+			end := strings.Index(url, "/")
+			if end < 0 {
+				end = len(url)
+			}
+			url = url[:i] + url[end:]
+		} else {
+			url = url[:i] + "/" + url[i+1:]
+		}
+	}
+
+	url = strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
+	return strings.ToLower(url)
+}
@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/hashicorp/terraform/configs"
+	log "github.com/sirupsen/logrus"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -17,40 +21,96 @@ func joinPath(elem ...string) string {
 	return filepath.ToSlash(filepath.Join(elem...))
 }
 
-func parseTerraformLocalModuleSource(module *configs.Module) ([]string, error) {
-	var sourceMap = map[string]bool{}
+// Adds a dependency on each of `files` in the directories of the local modules called by `module`
+func parseTerraformLocalModuleSource(module *configs.Module, files []string) ([]dependency, error) {
+	var sourceMap = map[string]dependency{}
+	for name, mc := range module.ModuleCalls {
+		if modulePath, ok := localModuleSourceDir(module, mc); ok {
+			for _, file := range files {
+				addDependency(sourceMap, dependency{
+					path:      moduleFilePath(modulePath, file),
+					mechanism: mechanismLocalModule,
+					detail:    fmt.Sprintf("module %q", name),
+					source:    mc.DeclRange,
+				})
+			}
+		}
+	}
+
+	return sortedDependencies(sourceMap), nil
+}
+
+// Joins a file glob to a module directory, keeping the `!` of exclusions in front
+func moduleFilePath(modulePath string, file string) string {
+	if strings.HasPrefix(file, "!") {
+		return "!" + joinPath(modulePath, strings.TrimPrefix(file, "!"))
+	}
+
+	return joinPath(modulePath, file)
+}
+
+// Lists the directories of the local modules called directly by `module`
+func localSubModuleDirs(module *configs.Module) []string {
+	var dirMap = map[string]bool{}
 	for _, mc := range module.ModuleCalls {
-		if isLocalTerraformModuleSource(mc.SourceAddr) && !isExcludedSubModule(mc.SourceAddr) {
-			modulePath := joinPath(module.SourceDir, mc.SourceAddr)
-			modulePathGlob := joinPath(modulePath, "*.tf*")
+		if modulePath, ok := localModuleSourceDir(module, mc); ok {
+			dirMap[modulePath] = true
+		}
+	}
 
-			if _, exists := sourceMap[modulePathGlob]; exists {
+	var dirs = []string{}
+	for dir := range dirMap {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	return dirs
+}
+
+// Loads all local modules called by `module`, following nested local module calls
+func loadLocalSubModules(module *configs.Module) []*configs.Module {
+	visited := map[string]bool{module.SourceDir: true}
+	var subModules []*configs.Module
+
+	var walk func(m *configs.Module)
+	walk = func(m *configs.Module) {
+		for _, mc := range m.ModuleCalls {
+			modulePath, ok := localModuleSourceDir(m, mc)
+			if !ok || visited[modulePath] {
+				continue
+			}
+			visited[modulePath] = true
+
+			subModule, diags := loadConfigDir(modulePath)
+			if subModule == nil {
+				log.Debugf("Failed to load local module at %s: %s", modulePath, diags.Error())
 				continue
 			}
-			sourceMap[modulePathGlob] = true
-
-			// find local module source recursively
-			//subModule, diags := configs.NewParser(nil).LoadConfigDir(modulePath)
-			//if diags.HasErrors() {
-			//	return nil, errors.New(diags.Error())
-			//}
-			//subSources, err := parseTerraformLocalModuleSource(subModule)
-			//if err != nil {
-			//	return nil, err
-			//}
-			//
-			//for _, subSource := range subSources {
-			//	sourceMap[subSource] = true
-			//}
+			subModules = append(subModules, subModule)
+			walk(subModule)
 		}
 	}
+	walk(module)
+
+	return subModules
+}
+
+// Resolves the directory of a module call when its source lives in this repo: either a local path,
+// or a remote source pointing back at this repo as configured by `--repo-url`
+func localModuleSourceDir(module *configs.Module, mc *configs.ModuleCall) (string, bool) {
+	if isExcludedSubModule(mc.SourceAddr) {
+		return "", false
+	}
+
+	if isLocalTerraformModuleSource(mc.SourceAddr) {
+		return filepath.Join(module.SourceDir, mc.SourceAddr), true
+	}
 
-	var sources = []string{}
-	for source := range sourceMap {
-		sources = append(sources, source)
+	if subDir, ok := sameRepoModuleSubDir(mc.SourceAddr); ok {
+		return filepath.Join(gitRoot, subDir), true
 	}
 
-	return sources, nil
+	return "", false
 }
 
 func isExcludedSubModule(addr string) bool {
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Name of the built-in project type used when nothing else is configured
+const terraformProjectType = "terraform"
+
+// Files of a Terraform root module that change what it plans
+var terraformProjectFiles = []string{
+	// Configuration, with the OpenTofu specific files
+	"*.tf",
+	"*.tf.json",
+	"*.tofu",
+	"*.tofu.json",
+
+	// Templates read by `templatefile()`, also when their path is only known when planning
+	"*.tftpl",
+
+	// Variable definitions and partial backend configurations
+	"*.tfvars",
+	"*.tfvars.json",
+	"*.tfbackend",
+
+	// Provider versions selected by `terraform init`
+	".terraform.lock.hcl",
+
+	// Tests and mocks of `terraform test`, next to the configuration or in the tests directory
+	"*.tftest.hcl",
+	"*.tftest.json",
+	"*.tfmock.hcl",
+	"*.tfmock.json",
+	"tests/**",
+}
+
+// Files of a project type that only matter in the root module itself. Terraform never reads them from the local
+// modules it calls when planning, so only their configuration is watched
+var rootModuleOnlyFiles = map[string]bool{
+	"*.tfvars":            true,
+	"*.tfvars.json":       true,
+	"*.tfbackend":         true,
+	".terraform.lock.hcl": true,
+	"*.tftest.hcl":        true,
+	"*.tftest.json":       true,
+	"*.tfmock.hcl":        true,
+	"*.tfmock.json":       true,
+	"tests/**":            true,
+}
+
+var builtinProjectTypes = map[string][]string{
+	terraformProjectType: terraformProjectFiles,
+}
+
+// A set of files triggering a plan, shared by projects of the same kind
+type ProjectType struct {
+	// Name of another project type whose files are included
+	Extends string `json:"extends,omitempty"`
+
+	// Globs of module-local files triggering a plan
+	AutoPlanFileList []string `json:"autoplan_file_list,omitempty"`
+}
+
+// Project types of the config file, loaded once per run together with the rules
+var projectTypes map[string]ProjectType
+
+func isKnownProjectType(name string, custom map[string]ProjectType) bool {
+	if _, ok := custom[name]; ok {
+		return true
+	}
+	_, ok := builtinProjectTypes[name]
+	return ok
+}
+
+// Lists the files of a project type, following `extends`. Types of the config file take precedence over built-in ones
+func resolveProjectTypeFiles(name string, custom map[string]ProjectType) ([]string, error) {
+	files := []string{}
+	seen := []string{}
+	for name != "" {
+		for _, previous := range seen {
+			if previous == name {
+				return nil, fmt.Errorf("project type %q extends itself through %s", name, strings.Join(seen, " -> "))
+			}
+		}
+		seen = append(seen, name)
+
+		projectType, ok := custom[name]
+		if !ok {
+			builtin, ok := builtinProjectTypes[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown project type %q, known types are %s", name, strings.Join(knownProjectTypes(custom), ", "))
+			}
+			return append(files, builtin...), nil
+		}
+
+		files = append(files, projectType.AutoPlanFileList...)
+		name = projectType.Extends
+	}
+
+	return files, nil
+}
+
+func knownProjectTypes(custom map[string]ProjectType) []string {
+	names := []string{}
+	for name := range builtinProjectTypes {
+		names = append(names, name)
+	}
+	for name := range custom {
+		if _, ok := builtinProjectTypes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Lists the files of a project type to watch in the local modules a project calls
+func subModuleFiles(files []string) []string {
+	moduleFiles := []string{}
+	for _, file := range files {
+		if !rootModuleOnlyFiles[file] {
+			moduleFiles = append(moduleFiles, file)
+		}
+	}
+
+	return moduleFiles
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Removes projects of the old config which should no longer exist: their directory was deleted, is excluded,
+// is no longer a root module, or was skipped in this run. Projects regenerated in this run and unmanaged projects are kept
+func pruneStaleProjects(projects []AtlantisProject, generatedDirs map[string]bool, visitedDirs map[string]bool, oldProjects map[string]oldProject) []AtlantisProject {
+	filter := newDirectoryFilter()
+	kept := []AtlantisProject{}
+	for _, project := range projects {
+		if generatedDirs[project.Dir] || oldProjects[project.Dir].unmanaged {
+			kept = append(kept, project)
+			continue
+		}
+
+		reason := staleProjectReason(project.Dir, visitedDirs, filter)
+		if reason == "" {
+			kept = append(kept, project)
+			continue
+		}
+
+		if dryRun {
+			log.Infof("Would prune stale project %s, as %s", project.Dir, reason)
+		} else {
+			log.Infof("Pruned stale project %s, as %s", project.Dir, reason)
+		}
+	}
+
+	return kept
+}
+
+// Explains why a project is stale, or returns an empty string if it is not
+func staleProjectReason(dir string, visitedDirs map[string]bool, filter *directoryFilter) string {
+	absoluteDir := filepath.Join(gitRoot, dir)
+
+	info, err := os.Stat(absoluteDir)
+	if err != nil || !info.IsDir() {
+		return "its directory no longer exists"
+	}
+
+	if isExcludedDir(absoluteDir, filter) {
+		return "it is excluded by --exclude or an .atlantisignore file"
+	}
+
+	if visitedDirs[dir] {
+		return "it was skipped"
+	}
+
+	module, _ := loadConfigDir(absoluteDir)
+	if module == nil || module.Backend == nil {
+		return "it is no longer a root module"
+	}
+
+	return ""
+}
+
+// Checks if a directory or one of its parents below the repo root is excluded, as the walk never enters excluded directories
+func isExcludedDir(dir string, filter *directoryFilter) bool {
+	root := filepath.Clean(gitRoot)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if filter.isExcluded(dir) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Registers the flags selecting the repo and its root modules on commands other than `generate`,
+// bound to the same variables so the discovery code behaves the same for all commands
+func addRepoFlags(cmd *cobra.Command) {
+	pwd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmd.Flags().StringVar(&gitRoot, "root", pwd, "Path to the root directory of the git repo. Default is current dir")
+	cmd.Flags().StringSliceVar(&includePatterns, "include", []string{}, "Glob of directories, relative to the root, that should be treated as projects. Supports '**'. Can be repeated. Default is all directories")
+	cmd.Flags().StringSliceVar(&excludePatterns, "exclude", []string{}, "Glob of directories, relative to the root, that should be skipped together with everything below them. Supports '**'. Can be repeated")
+}
+
+// Ensures the gitRoot has a trailing slash and is an absolute path
+func resolveGitRoot() error {
+	absoluteGitRoot, err := filepath.Abs(gitRoot)
+	if err != nil {
+		return err
+	}
+	gitRoot = absoluteGitRoot + string(filepath.Separator)
+
+	return nil
+}
+
+// Formats the start of a range as `file:line`, with the file relative to the repo root
+func relativeRange(r hcl.Range) string {
+	return fmt.Sprintf("%s:%d", relativeFile(r.Filename), r.Start.Line)
+}
+
+// Makes a file path relative to the repo root, if it is inside of it
+func relativeFile(path string) string {
+	if relativePath, ok := relativeToGitRoot(path); ok {
+		return relativePath
+	}
+
+	return filepath.ToSlash(path)
+}
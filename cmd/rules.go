@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/ghodss/yaml"
+)
+
+// Represents the file passed with `--config`
+type ConfigFile struct {
+	// Settings applied to every project whose directory matches, in order
+	Rules []ProjectRule `json:"rules"`
+
+	// Project types by name, in addition to the built-in ones
+	ProjectTypes map[string]ProjectType `json:"project_types"`
+}
+
+// Settings for all projects in directories matching a path pattern. Locals of a module take precedence over rules
+type ProjectRule struct {
+	// Regular expression matched against the project dir, relative to the repo root
+	Path string `json:"path"`
+
+	// Execution order group, pinned the same way as `atlantis.execution_order_group`
+	ExecutionOrderGroup *int `json:"execution_order_group,omitempty"`
+
+	// The Atlantis workflow to use
+	Workflow string `json:"workflow,omitempty"`
+
+	// Apply requirements to override the global `--apply-requirements` flag
+	ApplyRequirements []string `json:"apply_requirements,omitempty"`
+
+	// Overrides the `--autoplan` flag
+	AutoPlan *bool `json:"autoplan,omitempty"`
+
+	// Overrides the `--project-type` flag
+	ProjectType string `json:"project_type,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Rules of the config file, loaded once per run
+var projectRules []ProjectRule
+
+// Loads the rules of the config file passed with `--config`, if any
+func loadProjectRules() error {
+	projectRules = nil
+	projectTypes = nil
+	if configPath == "" {
+		return nil
+	}
+
+	configFile, err := readConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+	projectRules = configFile.Rules
+	projectTypes = configFile.ProjectTypes
+
+	return nil
+}
+
+// Reads the config file and compiles the path pattern of each rule
+func readConfigFile(path string) (*ConfigFile, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := ConfigFile{}
+	if err := yaml.UnmarshalStrict(bytes, &config, yaml.DisallowUnknownFields); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Path == "" {
+			return nil, fmt.Errorf("invalid config file %s: rule %d has no path", path, i+1)
+		}
+		rule.pattern, err = regexp.Compile(rule.Path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config file %s: path of rule %d: %w", path, i+1, err)
+		}
+		if rule.ProjectType != "" && !isKnownProjectType(rule.ProjectType, config.ProjectTypes) {
+			return nil, fmt.Errorf("invalid config file %s: rule %d has the unknown project type %q", path, i+1, rule.ProjectType)
+		}
+	}
+
+	for name := range config.ProjectTypes {
+		if _, err := resolveProjectTypeFiles(name, config.ProjectTypes); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	return &config, nil
+}
+
+// Combines the settings of all rules matching a project dir. Later rules override the fields set by earlier ones.
+// Also returns which rule each field comes from, by the name of the matching local
+func resolveRules(relativeDir string) (ResolvedLocals, map[string]string) {
+	resolved := ResolvedLocals{}
+	origins := map[string]string{}
+	for _, rule := range projectRules {
+		if !rule.pattern.MatchString(relativeDir) {
+			continue
+		}
+		explainf("%s matches rule %q of the config file", relativeDir, rule.Path)
+		origin := fmt.Sprintf("config rule %q", rule.Path)
+
+		if rule.ExecutionOrderGroup != nil {
+			resolved.ExecutionOrderGroup = rule.ExecutionOrderGroup
+			origins["execution_order_group"] = origin
+		}
+		if rule.Workflow != "" {
+			resolved.AtlantisWorkflow = rule.Workflow
+			origins["workflow"] = origin
+		}
+		if rule.ApplyRequirements != nil {
+			resolved.ApplyRequirements = rule.ApplyRequirements
+			origins["apply_requirements"] = origin
+		}
+		if rule.AutoPlan != nil {
+			resolved.AutoPlan = rule.AutoPlan
+			origins["autoplan"] = origin
+		}
+		if rule.ProjectType != "" {
+			resolved.ProjectType = rule.ProjectType
+			origins["project_type"] = origin
+		}
+	}
+
+	return resolved, origins
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/dennislapchenko/terraform-atlantis-config/internal/git"
+)
+
+// Lists the files, relative to the repo root, changed on `head` since it branched off from `base`. Renamed files
+// are listed with both their old and new path, as the change affects the projects depending on either
+func changedFilesBetween(base string, head string) ([]string, error) {
+	repo, err := git.Open(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := repo.ChangedFiles(base, head)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, change := range changes {
+		files = append(files, change.Paths()...)
+	}
+
+	return uniqueStrings(files), nil
+}
+
+// Decides which root modules `--since` regenerates. The old projects tell what each root module depended on
+type impactFilter struct {
+	oldProjects  map[string]AtlantisProject
+	changedFiles []string
+}
+
+func newImpactFilter(oldConfig *AtlantisConfig, changedFiles []string) *impactFilter {
+	filter := &impactFilter{oldProjects: map[string]AtlantisProject{}, changedFiles: changedFiles}
+	for _, project := range oldConfig.Projects {
+		filter.oldProjects[project.Dir] = project
+	}
+
+	return filter
+}
+
+// Checks if the root module in `path` has to be regenerated: when it has no old project, when one of its own files
+// changed, which may add dependencies, or when a change matches the `when_modified` entries of its old project
+func (f *impactFilter) isImpacted(path string) bool {
+	old, ok := f.oldProjects[relativeProjectDir(path)]
+	if !ok {
+		return true
+	}
+
+	for _, file := range f.changedFiles {
+		if filepath.Dir(filepath.Join(gitRoot, filepath.FromSlash(file))) == filepath.Clean(path) {
+			return true
+		}
+	}
+
+	return len(matchingChangedFiles(&old, path, f.changedFiles)) > 0
+}
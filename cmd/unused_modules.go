@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/terraform/configs"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Walks the repo and splits the directories with Terraform files into root modules and all others,
+// keeping only the others matched by `--include`
+func findModuleDirs(rootPath string) ([]*configs.Module, []string, error) {
+	var rootModules []*configs.Module
+	var moduleDirs []string
+	filter := newDirectoryFilter()
+
+	err := filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == ".terraform" || info.Name() == ".git" || filter.isExcluded(path) {
+			return filepath.SkipDir
+		}
+		if !isConfigDir(path) {
+			return nil
+		}
+
+		// All root modules are followed, as modules they call would otherwise show up as unused
+		module, _ := loadConfigDir(path)
+		if module != nil && module.Backend != nil {
+			rootModules = append(rootModules, module)
+		} else if filter.isIncluded(path) {
+			moduleDirs = append(moduleDirs, filepath.Clean(path))
+		}
+		return nil
+	})
+
+	return rootModules, moduleDirs, err
+}
+
+// Lists the module dirs that no root module calls, neither directly nor through other local modules
+func findUnusedModules(rootModules []*configs.Module, moduleDirs []string) []string {
+	referenced := map[string]bool{}
+	for _, rootModule := range rootModules {
+		for _, subModule := range loadLocalSubModules(rootModule) {
+			referenced[filepath.Clean(subModule.SourceDir)] = true
+		}
+	}
+
+	unused := []string{}
+	for _, dir := range moduleDirs {
+		if !referenced[dir] {
+			unused = append(unused, relativeFile(dir))
+		}
+	}
+	sort.Strings(unused)
+
+	return unused
+}
+
+func listUnusedModules(cmd *cobra.Command, args []string) error {
+	if err := resolveGitRoot(); err != nil {
+		return err
+	}
+
+	rootModules, moduleDirs, err := findModuleDirs(gitRoot)
+	if err != nil {
+		return err
+	}
+
+	unused := findUnusedModules(rootModules, moduleDirs)
+	for _, dir := range unused {
+		fmt.Fprintln(cmd.OutOrStdout(), dir)
+	}
+	log.Infof("Found %d unused of %d local modules, called from %d root modules", len(unused), len(moduleDirs), len(rootModules))
+
+	return nil
+}
+
+// unusedModulesCmd represents the unused-modules command
+var unusedModulesCmd = &cobra.Command{
+	Use:   "unused-modules",
+	Short: "Lists local modules that no root module uses",
+	Long:  `Lists the directories with Terraform files that are not root modules and are never called by a root module, neither directly nor through other local modules`,
+	RunE:  listUnusedModules,
+}
+
+func init() {
+	rootCmd.AddCommand(unusedModulesCmd)
+
+	addRepoFlags(unusedModulesCmd)
+	unusedModulesCmd.Flags().StringSliceVar(&repoURLs, "repo-url", []string{}, "Remote URLs of this repo, like 'github.com/org/infra'. Git and GitHub module sources pointing at them are followed like local modules. Supports '*' wildcards")
+}
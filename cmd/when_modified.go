@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// Cleans up the `when_modified` entries of a project: paths are cleaned, duplicates and entries already covered by
+// a broader glob are dropped, and sibling module globs are collapsed above `--collapse-when-modified-threshold`.
+// As later entries override earlier ones, only runs of consecutive includes or `!` exclusions are sorted, keeping
+// the order of the runs themselves
+func normalizeWhenModified(entries []string) []string {
+	normalized := []string{}
+	run := []string{}
+	excluding := false
+	for _, entry := range entries {
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, "!") != excluding {
+			normalized = append(normalized, normalizeWhenModifiedRun(run, excluding)...)
+			run = []string{}
+			excluding = !excluding
+		}
+		run = append(run, path.Clean(strings.TrimPrefix(entry, "!")))
+	}
+
+	return append(normalized, normalizeWhenModifiedRun(run, excluding)...)
+}
+
+// Normalizes a run of consecutive includes, or of exclusions without their `!` prefix
+func normalizeWhenModifiedRun(run []string, excluding bool) []string {
+	if !excluding && collapseWhenModifiedThreshold > 0 {
+		run = collapseSiblingGlobs(run, collapseWhenModifiedThreshold)
+	}
+
+	run = removeSubsumedEntries(run)
+	if excluding {
+		for i, exclude := range run {
+			run[i] = "!" + exclude
+		}
+	}
+
+	return run
+}
+
+// Removes duplicates and entries matched by another, broader entry. Returns the remaining entries sorted
+func removeSubsumedEntries(entries []string) []string {
+	unique := uniqueStrings(entries)
+
+	kept := []string{}
+	for _, entry := range unique {
+		subsumed := false
+		for _, other := range unique {
+			if other != entry && subsumes(other, entry) {
+				subsumed = true
+				break
+			}
+		}
+		if !subsumed {
+			kept = append(kept, entry)
+		}
+	}
+	sort.Strings(kept)
+
+	return kept
+}
+
+// Checks if every file matched by `entry` is also matched by `broader`. Globs only ever count as covered by
+// a `**` glob of a directory above them, as comparing two arbitrary globs is not possible by matching alone.
+// Entries outside of the project dir are only covered by patterns starting with the same `../` segments,
+// so a `**` of the project never drops the files of a parent directory
+func subsumes(broader string, entry string) bool {
+	if !isGlob(broader) || parentSegments(broader) != parentSegments(entry) {
+		return false
+	}
+
+	if !isGlob(entry) {
+		return matchPattern(broader, entry)
+	}
+
+	if broader == "**" {
+		return true
+	}
+	if strings.HasSuffix(broader, "/**") {
+		dir := strings.TrimSuffix(broader, "**")
+		return !isGlob(dir) && strings.HasPrefix(entry, dir)
+	}
+
+	return false
+}
+
+// Returns the leading `../` segments of an entry
+func parentSegments(entry string) string {
+	prefix := ""
+	for strings.HasPrefix(entry[len(prefix):], "../") {
+		prefix += "../"
+	}
+
+	return prefix
+}
+
+// Replaces more than `threshold` globs of sibling directories sharing the same pattern, like `../modules/a/*.tf`
+// and `../modules/b/*.tf`, by a single glob over their parent directory, like `../modules/*/*.tf`
+func collapseSiblingGlobs(entries []string, threshold int) []string {
+	type siblingKey struct {
+		parent  string
+		pattern string
+	}
+
+	siblings := map[siblingKey][]string{}
+	for _, entry := range entries {
+		dir, pattern := path.Split(entry)
+		dir = strings.TrimSuffix(dir, "/")
+		if dir == "" || isGlob(dir) || !isGlob(pattern) || path.Base(dir) == ".." {
+			continue
+		}
+		key := siblingKey{parent: path.Dir(dir), pattern: pattern}
+		siblings[key] = append(siblings[key], entry)
+	}
+
+	collapsed := map[string]string{}
+	for key, group := range siblings {
+		if len(uniqueStrings(group)) <= threshold {
+			continue
+		}
+		for _, entry := range group {
+			collapsed[entry] = joinPath(key.parent, "*", key.pattern)
+		}
+	}
+
+	result := []string{}
+	for _, entry := range entries {
+		if replacement, ok := collapsed[entry]; ok {
+			entry = replacement
+		}
+		result = append(result, entry)
+	}
+
+	return result
+}
+
+func isGlob(entry string) bool {
+	return strings.ContainsAny(entry, "*?[{")
+}
+
+// Checks if a path, relative to the project dir, triggers an autoplan. Like Atlantis, later entries override
+// earlier ones, so a `!` exclusion only drops matches of the entries before it. Returns the deciding include
+func whenModifiedMatch(entries []string, relativePath string) (string, bool) {
+	relativePath = path.Clean(relativePath)
+	matchedBy := ""
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, "!") {
+			if matchedBy != "" && matchPattern(strings.TrimPrefix(entry, "!"), relativePath) {
+				matchedBy = ""
+			}
+			continue
+		}
+		if matchPattern(entry, relativePath) {
+			matchedBy = entry
+		}
+	}
+
+	return matchedBy, matchedBy != ""
+}
@@ -0,0 +1,175 @@
+// Package git finds the files changed between refs of a local checkout, using the git binary
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Status of a changed file, as reported by `git diff --name-status`
+type Status byte
+
+const (
+	Added       Status = 'A'
+	Copied      Status = 'C'
+	Deleted     Status = 'D'
+	Modified    Status = 'M'
+	Renamed     Status = 'R'
+	TypeChanged Status = 'T'
+)
+
+// A file changed between two refs
+type Change struct {
+	Status Status
+
+	// Path of the file after the change, relative to the directory of the repo. For deletions, the deleted path
+	Path string
+
+	// Path of the file before it was renamed or copied, empty otherwise
+	OldPath string
+}
+
+// Lists the paths a change touches: both the old and the new path of a renamed file
+func (c Change) Paths() []string {
+	if c.OldPath != "" && c.Status == Renamed {
+		return []string{c.OldPath, c.Path}
+	}
+
+	return []string{c.Path}
+}
+
+// A local checkout. Paths are relative to Dir, which can be a subdirectory of the repo
+type Repo struct {
+	Dir string
+}
+
+// Opens the checkout containing dir. Fails when the git binary is not installed, as nothing else works without it
+func Open(dir string) (*Repo, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git must be installed to find changed files: %w", err)
+	}
+
+	repo := &Repo{Dir: dir}
+	if _, err := repo.run("rev-parse", "--git-dir"); err != nil {
+		return nil, fmt.Errorf("%s is not a git checkout: %w", dir, err)
+	}
+
+	return repo, nil
+}
+
+// Returns the first of the refs that exists in the checkout
+func (r *Repo) ResolveRef(candidates ...string) (string, bool) {
+	for _, ref := range candidates {
+		if _, err := r.run("rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+			return ref, true
+		}
+	}
+
+	return "", false
+}
+
+// Finds the commit `head` branched off from `base`
+func (r *Repo) MergeBase(base string, head string) (string, error) {
+	output, err := r.run("merge-base", base, head)
+	if err != nil {
+		return "", fmt.Errorf("failed to find the merge base of %s and %s: %w", base, head, err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Lists the files changed on `head` since it branched off from `base`, so changes made on `base` in the meantime
+// are left out. Renames are detected. An empty `head` compares against the working tree, including untracked files
+func (r *Repo) ChangedFiles(base string, head string) ([]Change, error) {
+	mergeBase, err := r.MergeBase(base, headOrHEAD(head))
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"diff", "--name-status", "-M", "-z", "--relative", mergeBase}
+	if head != "" {
+		args = append(args, head)
+	}
+	output, err := r.run(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s against %s: %w", headOrHEAD(head), base, err)
+	}
+
+	changes, err := parseNameStatus(output)
+	if err != nil {
+		return nil, err
+	}
+
+	if head == "" {
+		untracked, err := r.run("ls-files", "--others", "--exclude-standard", "-z")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list untracked files: %w", err)
+		}
+		for _, path := range splitNull(untracked) {
+			changes = append(changes, Change{Status: Added, Path: path})
+		}
+	}
+
+	return changes, nil
+}
+
+// Parses the NUL separated output of `git diff --name-status -z`, where renames and copies are followed by
+// both the old and the new path
+func parseNameStatus(output []byte) ([]Change, error) {
+	fields := splitNull(output)
+	changes := []Change{}
+	for i := 0; i < len(fields); i++ {
+		status := fields[i]
+		if status == "" || i+1 >= len(fields) {
+			return nil, fmt.Errorf("unexpected git diff output %q", string(output))
+		}
+
+		change := Change{Status: Status(status[0])}
+		if change.Status == Renamed || change.Status == Copied {
+			if i+2 >= len(fields) {
+				return nil, fmt.Errorf("unexpected git diff output %q", string(output))
+			}
+			change.OldPath, change.Path = fields[i+1], fields[i+2]
+			i += 2
+		} else {
+			change.Path = fields[i+1]
+			i++
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+func splitNull(output []byte) []string {
+	fields := []string{}
+	for _, field := range bytes.Split(output, []byte{0}) {
+		if len(field) > 0 {
+			fields = append(fields, string(field))
+		}
+	}
+
+	return fields
+}
+
+func headOrHEAD(head string) string {
+	if head == "" {
+		return "HEAD"
+	}
+	return head
+}
+
+func (r *Repo) run(args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.Dir}, args...)...)
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, err
+}
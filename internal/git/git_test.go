@@ -0,0 +1,113 @@
+package git
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runGit(t *testing.T, dir string, args ...string) {
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %s: %s", args, err, output)
+	}
+}
+
+func writeFile(t *testing.T, dir string, name string, contents string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet", "--initial-branch=main")
+	writeFile(t, dir, "renamed.tf", "variable \"renamed\" {\n  default = \"long enough to be detected as a rename\"\n}\n")
+	writeFile(t, dir, "deleted.tf", "variable \"deleted\" {}\n")
+	writeFile(t, dir, "modified.tf", "variable \"modified\" {}\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "--quiet", "-m", "Initial commit")
+
+	runGit(t, dir, "checkout", "--quiet", "-b", "feature")
+	runGit(t, dir, "mv", "renamed.tf", "moved.tf")
+	runGit(t, dir, "rm", "--quiet", "deleted.tf")
+	writeFile(t, dir, "modified.tf", "variable \"modified\" {\n  default = 1\n}\n")
+	runGit(t, dir, "commit", "--quiet", "-am", "Change files")
+
+	// Changes on the base branch after the feature branched off are not part of its changes
+	runGit(t, dir, "checkout", "--quiet", "main")
+	writeFile(t, dir, "base_only.tf", "variable \"base_only\" {}\n")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "--quiet", "-m", "Change base")
+	runGit(t, dir, "checkout", "--quiet", "feature")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := repo.ChangedFiles("main", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []Change{
+		{Status: Deleted, Path: "deleted.tf"},
+		{Status: Modified, Path: "modified.tf"},
+		{Status: Renamed, Path: "moved.tf", OldPath: "renamed.tf"},
+	}, changes)
+	assert.Equal(t, []string{"renamed.tf", "moved.tf"}, changes[2].Paths())
+
+	// Without a head, uncommitted and untracked files count as well
+	writeFile(t, dir, "untracked.tf", "variable \"untracked\" {}\n")
+	changes, err = repo.ChangedFiles("main", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, changes, Change{Status: Added, Path: "untracked.tf"})
+}
+
+func TestResolveRef(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "--quiet", "--initial-branch=main")
+	runGit(t, dir, "commit", "--quiet", "--allow-empty", "-m", "Initial commit")
+
+	repo, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, ok := repo.ResolveRef("origin/main", "main")
+	assert.True(t, ok)
+	assert.Equal(t, "main", ref)
+
+	_, ok = repo.ResolveRef("origin/missing")
+	assert.False(t, ok)
+}
+
+func TestOpenFailsOutsideOfCheckout(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+
+	_, err := Open(dir)
+	assert.Error(t, err)
+}
+
+func TestOpenFailsWithoutGit(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := Open(t.TempDir())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "git must be installed to find changed files")
+	}
+}
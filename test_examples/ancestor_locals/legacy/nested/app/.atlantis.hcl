@@ -0,0 +1,5 @@
+locals {
+  atlantis = {
+    autoplan = true
+  }
+}
@@ -0,0 +1,7 @@
+terraform {
+  backend "s3" {
+    bucket = "tf-state"
+    key    = "envs/prod/app/terraform.tfstate"
+    region = "eu-west-1"
+  }
+}
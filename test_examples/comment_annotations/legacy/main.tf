@@ -0,0 +1,2 @@
+# Nothing below here is managed by Atlantis anymore
+# atlantis: skip=true
@@ -0,0 +1,4 @@
+# atlantis: workflow=prod autoplan=false
+terraform {
+  backend "s3" {}
+}
@@ -0,0 +1,4 @@
+// atlantis: apply_requirements=["approved", "mergeable"] execution_order_group=2
+terraform {
+  required_version = ">= 1.5.0"
+}
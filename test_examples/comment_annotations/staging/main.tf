@@ -0,0 +1,11 @@
+# atlantis: workflow=staging terraform_version=1.5.7
+# atlantis: autoplan
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    workflow = "reviewed"
+  }
+}
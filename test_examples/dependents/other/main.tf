@@ -0,0 +1,7 @@
+terraform {
+  backend "s3" {}
+}
+
+module "subnet" {
+  source = "../modules/subnet"
+}
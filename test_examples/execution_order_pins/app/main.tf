@@ -0,0 +1,10 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    execution_order_group = 0
+    extra_dependencies    = ["../network/*.tf*"]
+  }
+}
@@ -0,0 +1,9 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    execution_order_group = 3
+  }
+}
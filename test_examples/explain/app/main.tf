@@ -0,0 +1,18 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    workflow           = "custom"
+    extra_dependencies = ["../shared/*.json", "main.tf"]
+  }
+}
+
+module "network" {
+  source = "../modules/network"
+}
+
+resource "aws_instance" "web" {
+  user_data = templatefile("${path.module}/templates/user_data.tftpl", {})
+}
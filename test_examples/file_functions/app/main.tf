@@ -0,0 +1,27 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  policies_dir = "${path.module}/policies"
+  policy       = file("${local.policies_dir}/policy.json")
+}
+
+resource "aws_instance" "app" {
+  user_data = templatefile("${path.module}/templates/userdata.sh.tftpl", {
+    name = "app"
+  })
+}
+
+resource "aws_s3_object" "configs" {
+  for_each = fileset(path.module, "configs/*.yaml")
+  key      = each.value
+}
+
+resource "aws_s3_object" "unknown" {
+  content = file(var.unknown_path)
+}
+
+module "lambda" {
+  source = "../modules/lambda"
+}
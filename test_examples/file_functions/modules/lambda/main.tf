@@ -0,0 +1,3 @@
+resource "aws_lambda_function" "this" {
+  source_code_hash = filebase64("${path.module}/src/handler.zip")
+}
@@ -0,0 +1,21 @@
+terraform {
+  required_version = ">= 1.0.0, < 2.0.0"
+
+  backend "s3" {}
+
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 4.0"
+    }
+  }
+}
+
+module "vpc" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "3.14.0"
+}
+
+module "network" {
+  source = "../modules/network"
+}
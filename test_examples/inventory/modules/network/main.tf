@@ -0,0 +1,12 @@
+terraform {
+  required_providers {
+    random = {
+      source  = "hashicorp/random"
+      version = ">= 3.0"
+    }
+  }
+}
+
+module "labels" {
+  source = "git::https://github.com/cloudposse/terraform-null-label.git?ref=0.25.0"
+}
@@ -0,0 +1,9 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    workflow = "custom-web"
+  }
+}
@@ -0,0 +1,31 @@
+terraform {
+  backend "s3" {}
+}
+
+variable "settings" {
+  type = object({
+    name    = string
+    enabled = optional(bool, true)
+  })
+}
+
+moved {
+  from = aws_instance.old
+  to   = aws_instance.new
+}
+
+import {
+  to = aws_instance.new
+  id = "i-0123456789"
+}
+
+check "health" {
+  assert {
+    condition     = var.settings.enabled
+    error_message = "The app is disabled"
+  }
+}
+
+removed {
+  from = aws_instance.legacy
+}
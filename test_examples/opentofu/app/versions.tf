@@ -0,0 +1,4 @@
+# Replaced by versions.tofu when running OpenTofu
+module "legacy" {
+  source = "../modules/legacy"
+}
@@ -0,0 +1,3 @@
+output "cidr_block" {
+  value = var.cidr_block
+}
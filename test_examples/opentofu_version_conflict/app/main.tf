@@ -0,0 +1,10 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    terraform_version = "1.5.7"
+    tofu_version      = "1.8.3"
+  }
+}
@@ -0,0 +1,28 @@
+terraform {
+  backend "s3" {}
+}
+
+data "archive_file" "lambda_x" {
+  type        = "zip"
+  source_dir  = "${path.module}/../src/lambda-x"
+  output_path = "${path.module}/lambda-x.zip"
+}
+
+resource "helm_release" "app" {
+  name  = "app"
+  chart = "../charts/app"
+}
+
+resource "helm_release" "remote" {
+  name       = "nginx"
+  repository = "https://charts.bitnami.com/bitnami"
+  chart      = "nginx"
+}
+
+data "kubectl_path_documents" "manifests" {
+  pattern = "${path.module}/../manifests/*.yaml"
+}
+
+resource "custom_uploader" "assets" {
+  directory = "${path.module}/../manifests"
+}
@@ -0,0 +1,10 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    project_type       = "lambda"
+    autoplan_file_list = ["*.tf"]
+  }
+}
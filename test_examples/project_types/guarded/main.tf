@@ -0,0 +1,9 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    project_type = "policy"
+  }
+}
@@ -0,0 +1,13 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    extra_dependencies = [
+      "//shared/versions.tf",
+      "//shared/policies/*.json",
+      "../common.tfvars",
+    ]
+  }
+}
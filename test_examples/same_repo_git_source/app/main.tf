@@ -0,0 +1,15 @@
+terraform {
+  backend "s3" {}
+}
+
+module "vpc" {
+  source = "git::ssh://git@github.com/our-org/infra.git//modules/vpc?ref=main"
+}
+
+module "dns" {
+  source = "github.com/our-org/infra//modules/dns"
+}
+
+module "other_repo" {
+  source = "git::https://github.com/our-org/other.git//modules/vpc?ref=v1.0.0"
+}
@@ -0,0 +1 @@
+resource "aws_route53_zone" "this" {}
@@ -0,0 +1,3 @@
+module "orphan" {
+  source = "../orphan"
+}
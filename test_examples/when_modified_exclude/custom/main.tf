@@ -0,0 +1,10 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    autoplan_file_list    = ["*.tf", "values/*.yaml"]
+    when_modified_exclude = ["README.md"]
+  }
+}
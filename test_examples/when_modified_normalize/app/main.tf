@@ -0,0 +1,26 @@
+terraform {
+  backend "s3" {}
+}
+
+locals {
+  atlantis = {
+    extra_dependencies = [
+      "./main.tf",
+      "../shared/../shared/*.json",
+      "values/**",
+      "values/prod.yaml",
+    ]
+  }
+}
+
+module "a" {
+  source = "../modules/a"
+}
+
+module "b" {
+  source = "../modules/b"
+}
+
+module "c" {
+  source = "./../modules/c"
+}